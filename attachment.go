@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	defaultUploadSizeLimit = 8 << 20
+	tier2UploadSizeLimit   = 50 << 20
+	tier3UploadSizeLimit   = 100 << 20
+)
+
+var (
+	errAttachmentTooLarge = errors.New("attachment is larger than the upload size limit")
+
+	attachmentHTTPClient = &http.Client{Timeout: 30 * time.Second}
+)
+
+// attachmentFile is an attachment that has been downloaded so that it can be uploaded to another channel.
+//
+// The content is kept in memory rather than as a reader, because a message may have to be sent more than once
+// (e.g. if sending it through a webhook fails)
+type attachmentFile struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// splitAttachments separates the attachments that can be uploaded to the target channel from the ones that are too
+// large to be uploaded and must therefore be linked instead
+func splitAttachments(bot *discordgo.Session, attachments []*discordgo.MessageAttachment, targetChannelID string) (attachmentsToUpload, attachmentsToLink []*discordgo.MessageAttachment) {
+	remainingUploadSize := getUploadSizeLimit(bot, targetChannelID)
+	for _, attachment := range attachments {
+		if attachment.Size > remainingUploadSize {
+			attachmentsToLink = append(attachmentsToLink, attachment)
+			continue
+		}
+		remainingUploadSize -= attachment.Size
+		attachmentsToUpload = append(attachmentsToUpload, attachment)
+	}
+	return
+}
+
+// getUploadSizeLimit returns the maximum size of the files in a message sent in the channel passed as parameter
+func getUploadSizeLimit(bot *discordgo.Session, channelID string) int {
+	channel, err := getChannel(bot, channelID)
+	if err != nil {
+		return defaultUploadSizeLimit
+	}
+	guild, err := bot.State.Guild(channel.GuildID)
+	if err != nil {
+		if guild, err = bot.Guild(channel.GuildID); err != nil {
+			return defaultUploadSizeLimit
+		}
+	}
+	switch guild.PremiumTier {
+	case discordgo.PremiumTier2:
+		return tier2UploadSizeLimit
+	case discordgo.PremiumTier3:
+		return tier3UploadSizeLimit
+	default:
+		return defaultUploadSizeLimit
+	}
+}
+
+// downloadAttachment downloads an attachment so that it can be uploaded to another channel.
+// The filename is preserved, which also preserves whether the attachment is marked as a spoiler.
+func downloadAttachment(attachment *discordgo.MessageAttachment) (*attachmentFile, error) {
+	response, err := attachmentHTTPClient.Get(attachment.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download attachment %s: %s", attachment.Filename, response.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(response.Body, int64(attachment.Size)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > attachment.Size {
+		return nil, errAttachmentTooLarge
+	}
+	contentType := response.Header.Get("Content-Type")
+	if len(contentType) == 0 {
+		contentType = mime.TypeByExtension(filepath.Ext(attachment.Filename))
+	}
+	return &attachmentFile{Name: attachment.Filename, ContentType: contentType, Data: data}, nil
+}
+
+// toDiscordFiles converts attachment files into files that can be sent with discordgo
+func toDiscordFiles(files []*attachmentFile) []*discordgo.File {
+	discordFiles := make([]*discordgo.File, 0, len(files))
+	for _, file := range files {
+		discordFiles = append(discordFiles, &discordgo.File{Name: file.Name, ContentType: file.ContentType, Reader: bytes.NewReader(file.Data)})
+	}
+	return discordFiles
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// buildMultipartBody creates a multipart body containing the JSON payload passed as parameter as well as the files
+func buildMultipartBody(payload []byte, files []*attachmentFile) (contentType string, body []byte, err error) {
+	buffer := &bytes.Buffer{}
+	writer := multipart.NewWriter(buffer)
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", `form-data; name="payload_json"`)
+	header.Set("Content-Type", "application/json")
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err = part.Write(payload); err != nil {
+		return "", nil, err
+	}
+	for i, file := range files {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file%d"; filename="%s"`, i, quoteEscaper.Replace(file.Name)))
+		if len(file.ContentType) > 0 {
+			header.Set("Content-Type", file.ContentType)
+		} else {
+			header.Set("Content-Type", "application/octet-stream")
+		}
+		if part, err = writer.CreatePart(header); err != nil {
+			return "", nil, err
+		}
+		if _, err = part.Write(file.Data); err != nil {
+			return "", nil, err
+		}
+	}
+	if err = writer.Close(); err != nil {
+		return "", nil, err
+	}
+	return writer.FormDataContentType(), buffer.Bytes(), nil
+}
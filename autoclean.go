@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TwiN/discord-channel-proxy-bot/database"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// autocleanInterval is how often messages older than the retention period of their channel are deleted
+	autocleanInterval = 10 * time.Minute
+
+	// maximumAutocleanPagesPerChannel is the maximum number of pages of 100 messages deleted per channel every
+	// autocleanInterval, so that a channel with a large backlog doesn't hold up the other channels
+	maximumAutocleanPagesPerChannel = 10
+
+	// maximumAutocleanSingleDeletesPerChannel is the maximum number of messages deleted one at a time per channel every
+	// autocleanInterval. Messages that are too old to be deleted in bulk must be deleted one at a time, which is much
+	// slower, so the remaining ones are left for the next runs.
+	maximumAutocleanSingleDeletesPerChannel = 50
+
+	// maximumBulkDeleteAge is how old messages can be to be deleted in bulk, minus a margin so that messages don't
+	// become too old between the moment they're retrieved and the moment they're deleted
+	maximumBulkDeleteAge = 14*24*time.Hour - time.Hour
+
+	// discordEpoch is the first millisecond of 2015, which is the epoch used by Discord's snowflakes
+	discordEpoch = 1420070400000
+)
+
+// HandleAutoclean shows or configures the retention policy of the channel in which the command was sent.
+//
+// Usage: autoclean [DURATION [keep-pinned]|off]
+func HandleAutoclean(bot *discordgo.Session, channelID, query string) {
+	arguments := strings.Fields(strings.ToLower(query))
+	if len(arguments) == 0 {
+		policy, err := database.GetRetentionPolicy(channelID)
+		if err != nil {
+			if err == database.ErrNotFound {
+				_ = sendEmbed(bot, channelID, "Autoclean is disabled", fmt.Sprintf("Type `%sautoclean DURATION` to enable it (e.g. `24h` or `7d`)", botCommandPrefix))
+			} else {
+				_ = sendEmbed(bot, channelID, "Failed to retrieve autoclean policy", "```"+err.Error()+"```")
+			}
+			return
+		}
+		_ = sendEmbed(bot, channelID, "Autoclean is enabled", describeRetentionPolicy(policy))
+		return
+	}
+	if arguments[0] == "off" || arguments[0] == "disable" || arguments[0] == "none" {
+		if err := database.DeleteRetentionPolicy(channelID); err != nil && err != database.ErrNotFound {
+			_ = sendEmbed(bot, channelID, "Failed to disable autoclean", "```"+err.Error()+"```")
+			return
+		}
+		_ = sendEmbed(bot, channelID, "Autoclean disabled", "")
+		return
+	}
+	retention, err := parseDuration(arguments[0])
+	if err != nil || retention < time.Minute {
+		_ = sendEmbed(bot, channelID, "Invalid duration "+arguments[0], "The duration must be at least one minute (e.g. `30m`, `24h` or `7d`)")
+		return
+	}
+	policy := &database.RetentionPolicy{ChannelID: channelID, Retention: retention, KeepPinned: len(arguments) > 1 && arguments[1] == "keep-pinned"}
+	if err = database.SetRetentionPolicy(policy); err != nil {
+		_ = sendEmbed(bot, channelID, "Failed to enable autoclean", "```"+err.Error()+"```")
+		return
+	}
+	_ = sendEmbed(bot, channelID, "Autoclean enabled", describeRetentionPolicy(policy))
+}
+
+func describeRetentionPolicy(policy *database.RetentionPolicy) string {
+	description := "Messages older than " + formatDuration(policy.Retention) + " are deleted automatically"
+	if policy.KeepPinned {
+		description += ", except pinned messages"
+	}
+	return description
+}
+
+// autoclean periodically deletes the messages that are older than the retention period of the channel they're in
+func autoclean(bot *discordgo.Session) {
+	for range time.Tick(autocleanInterval) {
+		policies, err := database.GetRetentionPolicies()
+		if err != nil {
+			log.Println("[autoclean] Failed to retrieve retention policies:", err.Error())
+			continue
+		}
+		for _, policy := range policies {
+			cleanChannel(bot, policy)
+		}
+	}
+}
+
+// cleanChannel deletes the messages of a channel that are older than the retention period of the channel.
+// Messages recent enough to be deleted in bulk are deleted in bulk, and the others are deleted one at a time, up to
+// maximumAutocleanSingleDeletesPerChannel messages.
+func cleanChannel(bot *discordgo.Session, policy *database.RetentionPolicy) {
+	// Only messages sent before the snowflake of the cutoff are retrieved, so there's no need to check their timestamp
+	beforeID := timeToSnowflake(time.Now().Add(-policy.Retention))
+	bulkDeleteAfterID := timeToSnowflake(time.Now().Add(-maximumBulkDeleteAge))
+	singleDeletesLeft := maximumAutocleanSingleDeletesPerChannel
+	for page := 0; page < maximumAutocleanPagesPerChannel; page++ {
+		messages, err := bot.ChannelMessages(policy.ChannelID, 100, beforeID, "", "")
+		if err != nil {
+			log.Printf("[cleanChannel] Failed to retrieve messages in channel=%s: %s", policy.ChannelID, err.Error())
+			return
+		}
+		if len(messages) == 0 {
+			return
+		}
+		var ids, oldIDs []string
+		for _, message := range messages {
+			if policy.KeepPinned && message.Pinned {
+				continue
+			}
+			if compareSnowflakes(message.ID, bulkDeleteAfterID) > 0 {
+				ids = append(ids, message.ID)
+			} else {
+				oldIDs = append(oldIDs, message.ID)
+			}
+		}
+		// Deleting these messages will trigger HandleMessageDeleteBulk, which will take care of deleting their copies
+		if err = deleteMessages(bot, policy.ChannelID, ids); err != nil {
+			log.Printf("[cleanChannel] Failed to delete messages in channel=%s: %s", policy.ChannelID, err.Error())
+			return
+		}
+		if len(oldIDs) > singleDeletesLeft {
+			oldIDs = oldIDs[:singleDeletesLeft]
+		}
+		for _, id := range oldIDs {
+			// Deleting this message will trigger HandleMessageDelete, which will take care of deleting its copies
+			if err = bot.ChannelMessageDelete(policy.ChannelID, id); err != nil && !isRESTError(err, discordgo.ErrCodeUnknownMessage) {
+				log.Printf("[cleanChannel] Failed to delete message=%s in channel=%s: %s", id, policy.ChannelID, err.Error())
+				return
+			}
+		}
+		singleDeletesLeft -= len(oldIDs)
+		log.Printf("[cleanChannel] Deleted %d messages in channel=%s", len(ids)+len(oldIDs), policy.ChannelID)
+		if singleDeletesLeft == 0 {
+			log.Printf("[cleanChannel] Leaving the remaining messages of channel=%s for the next run", policy.ChannelID)
+			return
+		}
+		if len(messages) < 100 {
+			return
+		}
+		beforeID = messages[len(messages)-1].ID
+	}
+}
+
+// timeToSnowflake returns the smallest snowflake that could have been generated at the time passed as parameter
+func timeToSnowflake(t time.Time) string {
+	return strconv.FormatInt((t.UnixNano()/int64(time.Millisecond)-discordEpoch)<<22, 10)
+}
@@ -4,12 +4,24 @@ import (
 	"database/sql"
 	"errors"
 	"log"
+	"strings"
+	"time"
 
 	_ "modernc.org/sqlite"
 )
 
 var (
-	ErrNotFound = errors.New("not found")
+	ErrNotFound         = errors.New("not found")
+	ErrAlreadyConnected = errors.New("channels are already connected")
+)
+
+const (
+	// DirectionBoth is the direction of connections through which messages are proxied from both channels
+	DirectionBoth = "both"
+
+	// DirectionOneWay is the direction of connections through which messages are only proxied from the first channel
+	// (the publisher) to the second channel (the subscriber)
+	DirectionOneWay = "one-way"
 )
 
 var db *sql.DB
@@ -42,46 +54,417 @@ func createSchema() error {
 		CREATE TABLE IF NOT EXISTS connection (
 			first_channel_id   VARCHAR(64) REFERENCES channel(channel_id) ON DELETE CASCADE, 
 			second_channel_id  VARCHAR(64) REFERENCES channel(channel_id) ON DELETE CASCADE,
-			UNIQUE (first_channel_id),
-			UNIQUE (second_channel_id)
+			allowed_mentions   VARCHAR(64) NOT NULL DEFAULT 'users',
+			direction          VARCHAR(16) NOT NULL DEFAULT 'both',
+			UNIQUE (first_channel_id, second_channel_id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	if err = addColumnIfNotExists("connection", "allowed_mentions", "VARCHAR(64) NOT NULL DEFAULT 'users'"); err != nil {
+		return err
+	}
+	if err = migrateConnectionTable(); err != nil {
+		return err
+	}
+	if err = addColumnIfNotExists("connection", "first_channel_locked", "INTEGER NOT NULL DEFAULT FALSE"); err != nil {
+		return err
+	}
+	if err = addColumnIfNotExists("connection", "second_channel_locked", "INTEGER NOT NULL DEFAULT FALSE"); err != nil {
+		return err
+	}
+	// The creation date of connections created before this column was added is unknown, hence the default of 0
+	if err = addColumnIfNotExists("connection", "created_at", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err = addColumnIfNotExists("connection", "first_channel_review_channel_id", "VARCHAR(64) NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err = addColumnIfNotExists("connection", "second_channel_review_channel_id", "VARCHAR(64) NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	// The types of mentions allowed in messages proxied to each channel of a connection are set by that channel, and
+	// replace the allowed_mentions column which either channel could change
+	if err = addColumnIfNotExists("connection", "first_channel_allowed_mentions", "VARCHAR(64) NOT NULL DEFAULT 'users'"); err != nil {
+		return err
+	}
+	if err = addColumnIfNotExists("connection", "second_channel_allowed_mentions", "VARCHAR(64) NOT NULL DEFAULT 'users'"); err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS hub (
+			hub_name    VARCHAR(32) PRIMARY KEY,
+			created_at  TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS hub_channel (
+			hub_name          VARCHAR(32) NOT NULL REFERENCES hub(hub_name) ON DELETE CASCADE,
+			channel_id        VARCHAR(64) NOT NULL REFERENCES channel(channel_id) ON DELETE CASCADE,
+			allowed_mentions  VARCHAR(64) NOT NULL DEFAULT 'users',
+			UNIQUE (channel_id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	if err = addColumnIfNotExists("hub_channel", "allowed_mentions", "VARCHAR(64) NOT NULL DEFAULT 'users'"); err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS webhook (
+			channel_id     VARCHAR(64)  PRIMARY KEY REFERENCES channel(channel_id) ON DELETE CASCADE,
+			webhook_id     VARCHAR(64)  NOT NULL,
+			webhook_token  VARCHAR(255) NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS proxied_message (
+			source_channel_id  VARCHAR(64) NOT NULL,
+			source_message_id  VARCHAR(64) NOT NULL,
+			proxy_channel_id   VARCHAR(64) NOT NULL,
+			proxy_message_id   VARCHAR(64) NOT NULL,
+			webhook_id         VARCHAR(64) NOT NULL DEFAULT '',
+			UNIQUE (proxy_message_id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	if err = addColumnIfNotExists("proxied_message", "part", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS proxied_message_source_message_id_index ON proxied_message (source_message_id)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS bind_request (
+			request_type     VARCHAR(16) NOT NULL,
+			from_channel_id  VARCHAR(64) NOT NULL,
+			to_channel_id    VARCHAR(64) NOT NULL,
+			created_at       INTEGER     NOT NULL,
+			expires_at       INTEGER     NOT NULL,
+			UNIQUE (request_type, from_channel_id, to_channel_id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS command_role (
+			guild_id  VARCHAR(64) NOT NULL,
+			command   VARCHAR(32) NOT NULL,
+			role_id   VARCHAR(64) NOT NULL,
+			UNIQUE (guild_id, command)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS retention_policy (
+			channel_id         VARCHAR(64) PRIMARY KEY,
+			retention_seconds  INTEGER     NOT NULL,
+			keep_pinned        INTEGER     NOT NULL DEFAULT FALSE
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS held_message (
+			held_message_id    INTEGER     PRIMARY KEY AUTOINCREMENT,
+			source_channel_id  VARCHAR(64) NOT NULL,
+			source_message_id  VARCHAR(64) NOT NULL,
+			target_channel_id  VARCHAR(64) NOT NULL,
+			created_at         INTEGER     NOT NULL,
+			UNIQUE (source_message_id, target_channel_id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS lock_timer (
+			channel_id        VARCHAR(64) NOT NULL,
+			other_channel_id  VARCHAR(64) NOT NULL DEFAULT '',
+			unlock_at         INTEGER     NOT NULL,
+			pull              INTEGER     NOT NULL DEFAULT FALSE,
+			UNIQUE (channel_id, other_channel_id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS lock_schedule (
+			channel_id    VARCHAR(64)  PRIMARY KEY,
+			start_minute  INTEGER      NOT NULL,
+			end_minute    INTEGER      NOT NULL,
+			timezone      VARCHAR(64)  NOT NULL,
+			weekdays      INTEGER      NOT NULL,
+			pull          INTEGER      NOT NULL DEFAULT FALSE,
+			locked        INTEGER
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS review (
+			review_channel_id  VARCHAR(64) NOT NULL,
+			review_message_id  VARCHAR(64) PRIMARY KEY,
+			source_channel_id  VARCHAR(64) NOT NULL,
+			source_message_id  VARCHAR(64) NOT NULL,
+			target_channel_id  VARCHAR(64) NOT NULL,
+			created_at         INTEGER     NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS filter_rule (
+			filter_rule_id    INTEGER     PRIMARY KEY AUTOINCREMENT,
+			channel_id        VARCHAR(64) NOT NULL,
+			other_channel_id  VARCHAR(64) NOT NULL,
+			rule_type         VARCHAR(16) NOT NULL,
+			pattern           TEXT        NOT NULL,
+			action            VARCHAR(16) NOT NULL,
+			created_at        INTEGER     NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS blocked_message (
+			blocked_message_id  INTEGER     PRIMARY KEY AUTOINCREMENT,
+			source_channel_id   VARCHAR(64) NOT NULL,
+			source_message_id   VARCHAR(64) NOT NULL,
+			target_channel_id   VARCHAR(64) NOT NULL,
+			author_id           VARCHAR(64) NOT NULL,
+			filter_rule_id      INTEGER     NOT NULL,
+			reason              TEXT        NOT NULL,
+			created_at          INTEGER     NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS bridge_mute (
+			channel_id        VARCHAR(64) NOT NULL,
+			other_channel_id  VARCHAR(64) NOT NULL,
+			user_id           VARCHAR(64) NOT NULL,
+			banned            INTEGER     NOT NULL DEFAULT FALSE,
+			expires_at        INTEGER     NOT NULL DEFAULT 0,
+			notified          INTEGER     NOT NULL DEFAULT FALSE,
+			created_at        INTEGER     NOT NULL,
+			UNIQUE (channel_id, other_channel_id, user_id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	if err = migrateRateLimitTable(); err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS rate_limit (
+			channel_id              VARCHAR(64) NOT NULL,
+			other_channel_id        VARCHAR(64) NOT NULL,
+			user_messages           INTEGER     NOT NULL,
+			user_period_seconds     INTEGER     NOT NULL,
+			binding_messages        INTEGER     NOT NULL,
+			binding_period_seconds  INTEGER     NOT NULL,
+			delay                   INTEGER     NOT NULL DEFAULT FALSE,
+			UNIQUE (channel_id, other_channel_id)
 		)
 	`)
 	return err
 }
 
+// addColumnIfNotExists adds a column to an existing table, unless the table already has a column with the same name
+func addColumnIfNotExists(table, column, definition string) error {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info($1) WHERE name = $2", table, column).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	log.Printf("[database][addColumnIfNotExists] Adding column %s to table %s", column, table)
+	_, err := db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	return err
+}
+
+// migrateRateLimitTable drops the rate_limit table if it was created before rate limits were set per binding by the
+// channel receiving the messages. The rate limits it contains were set by the channel sending the messages, so they
+// can't be carried over to the channel receiving them.
+func migrateRateLimitTable() error {
+	var columns, otherChannelIDColumns int
+	if err := db.QueryRow("SELECT COUNT(*), COUNT(CASE WHEN name = 'other_channel_id' THEN 1 END) FROM pragma_table_info('rate_limit')").Scan(&columns, &otherChannelIDColumns); err != nil {
+		return err
+	}
+	if columns == 0 || otherChannelIDColumns > 0 {
+		return nil
+	}
+	log.Println("[database][migrateRateLimitTable] Dropping rate limits set by the channels sending the messages")
+	_, err := db.Exec("DROP TABLE rate_limit")
+	return err
+}
+
+// migrateConnectionTable rebuilds the connection table if it was created before connections had a direction, because
+// the connection table used to prevent a channel from being part of more than one connection, which is incompatible
+// with one-way connections, and SQLite does not support dropping constraints.
+func migrateConnectionTable() error {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('connection') WHERE name = 'direction'").Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	log.Println("[database][migrateConnectionTable] Migrating connection table to support one-way connections")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	statements := []string{
+		`CREATE TABLE connection_new (
+			first_channel_id   VARCHAR(64) REFERENCES channel(channel_id) ON DELETE CASCADE, 
+			second_channel_id  VARCHAR(64) REFERENCES channel(channel_id) ON DELETE CASCADE,
+			allowed_mentions   VARCHAR(64) NOT NULL DEFAULT 'users',
+			direction          VARCHAR(16) NOT NULL DEFAULT 'both',
+			UNIQUE (first_channel_id, second_channel_id)
+		)`,
+		"INSERT INTO connection_new (first_channel_id, second_channel_id, allowed_mentions) SELECT first_channel_id, second_channel_id, allowed_mentions FROM connection",
+		"DROP TABLE connection",
+		"ALTER TABLE connection_new RENAME TO connection",
+	}
+	for _, statement := range statements {
+		if _, err = tx.Exec(statement); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CreateConnection creates a connection through which messages are proxied from both channels.
+// A channel can be part of any number of connections, but two channels can only be connected once.
 func CreateConnection(firstChannelID, secondChannelID string) error {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM connection WHERE first_channel_id IN ($1, $2) AND second_channel_id IN ($1, $2) AND direction = 'both'", firstChannelID, secondChannelID).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrAlreadyConnected
+	}
+	return createConnection(firstChannelID, secondChannelID, DirectionBoth)
+}
+
+// CreateOneWayConnection creates a connection through which messages are only proxied from the publisher channel to
+// the subscriber channel.
+// A publisher can have any number of subscribers, and a subscriber can subscribe to any number of publishers.
+func CreateOneWayConnection(publisherChannelID, subscriberChannelID string) error {
+	return createConnection(publisherChannelID, subscriberChannelID, DirectionOneWay)
+}
+
+func createConnection(firstChannelID, secondChannelID, direction string) error {
 	if err := createChannel(firstChannelID); err != nil {
 		return err
 	}
 	if err := createChannel(secondChannelID); err != nil {
 		return err
 	}
-	_, err := db.Exec("INSERT INTO connection (first_channel_id, second_channel_id) VALUES ($1, $2)", firstChannelID, secondChannelID)
+	_, err := db.Exec("INSERT INTO connection (first_channel_id, second_channel_id, direction, created_at) VALUES ($1, $2, $3, $4)", firstChannelID, secondChannelID, direction, time.Now().Unix())
 	return err
 }
 
-// GetOtherChannelIDFromConnection gets the other channel ID from a connection, or returns ErrNotFound if
-// there is no connection with the related ID
-func GetOtherChannelIDFromConnection(channelID string) (string, error) {
-	rows, err := db.Query("SELECT first_channel_id, second_channel_id FROM connection WHERE first_channel_id = $1 OR second_channel_id = $1", channelID)
+// GetConnectionCreatedAt returns when the connection between two channels was created, or a zero time if the
+// connection was created before its creation date was kept track of
+func GetConnectionCreatedAt(channelID, otherChannelID string) (time.Time, error) {
+	var createdAt int64
+	err := db.QueryRow("SELECT created_at FROM connection WHERE first_channel_id IN ($1, $2) AND second_channel_id IN ($1, $2)", channelID, otherChannelID).Scan(&createdAt)
 	if err != nil {
-		return "", err
+		if err == sql.ErrNoRows {
+			return time.Time{}, ErrNotFound
+		}
+		return time.Time{}, err
 	}
-	var firstChannelID, secondChannelID string
-	var found bool
-	for rows.Next() {
-		_ = rows.Scan(&firstChannelID, &secondChannelID)
-		found = true
-		break
+	if createdAt == 0 {
+		return time.Time{}, nil
 	}
-	_ = rows.Close()
-	if !found {
-		return "", ErrNotFound
+	return time.Unix(createdAt, 0), nil
+}
+
+// GetConnectedChannelIDs returns the IDs of all channels connected to the channel passed as parameter through
+// connections through which messages are proxied from both channels
+func GetConnectedChannelIDs(channelID string) ([]string, error) {
+	return queryChannelIDs(`
+		SELECT second_channel_id FROM connection WHERE first_channel_id = $1 AND direction = 'both'
+		UNION
+		SELECT first_channel_id FROM connection WHERE second_channel_id = $1 AND direction = 'both'
+	`, channelID)
+}
+
+// GetAllowedMentions returns the types of mentions that are allowed in messages proxied from the source channel to the
+// target channel, as set by the target channel for its connection with the source channel, or for the hub both channels
+// are members of
+func GetAllowedMentions(sourceChannelID, targetChannelID string) ([]string, error) {
+	var allowedMentions string
+	err := db.QueryRow(`
+		SELECT CASE WHEN first_channel_id = $2 THEN first_channel_allowed_mentions ELSE second_channel_allowed_mentions END FROM connection
+		WHERE (first_channel_id = $1 AND second_channel_id = $2) OR (first_channel_id = $2 AND second_channel_id = $1)
+		LIMIT 1
+	`, sourceChannelID, targetChannelID).Scan(&allowedMentions)
+	if err == sql.ErrNoRows {
+		// The channels may be members of the same hub rather than connected to one another
+		err = db.QueryRow(`
+			SELECT target_hub_channel.allowed_mentions FROM hub_channel target_hub_channel
+			JOIN hub_channel source_hub_channel ON source_hub_channel.hub_name = target_hub_channel.hub_name AND source_hub_channel.channel_id = $1
+			WHERE target_hub_channel.channel_id = $2
+		`, sourceChannelID, targetChannelID).Scan(&allowedMentions)
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if len(allowedMentions) == 0 {
+		return nil, nil
+	}
+	return strings.Split(allowedMentions, ","), nil
+}
+
+// SetAllowedMentions sets the types of mentions that are allowed in messages proxied to the channel passed as parameter
+// from the other channel through their connection, or returns ErrNotFound if there is no such connection.
+// To set the types of mentions that are allowed in messages proxied to a channel through its hub, use
+// SetHubChannelAllowedMentions instead.
+func SetAllowedMentions(channelID, otherChannelID string, allowedMentions []string) error {
+	result, err := db.Exec("UPDATE connection SET first_channel_allowed_mentions = $1 WHERE first_channel_id = $2 AND second_channel_id = $3", strings.Join(allowedMentions, ","), channelID, otherChannelID)
+	if err != nil {
+		return err
 	}
-	if firstChannelID == channelID {
-		return secondChannelID, nil
+	firstRowsAffected, _ := result.RowsAffected()
+	if result, err = db.Exec("UPDATE connection SET second_channel_allowed_mentions = $1 WHERE first_channel_id = $3 AND second_channel_id = $2", strings.Join(allowedMentions, ","), channelID, otherChannelID); err != nil {
+		return err
+	}
+	if secondRowsAffected, _ := result.RowsAffected(); firstRowsAffected+secondRowsAffected == 0 {
+		return ErrNotFound
 	}
-	return firstChannelID, nil
+	return nil
 }
 
 func IsChannelLocked(channelID string) (locked bool) {
@@ -97,16 +480,201 @@ func LockChannel(channelID string, unlock bool) error {
 	return err
 }
 
-func DeleteConnectionByChannelID(channelID string) error {
-	otherChannelID, err := GetOtherChannelIDFromConnection(channelID)
+// IsLocked checks whether messages from the source channel must be held rather than proxied to the target channel,
+// which is the case if the target channel is locked, or if the target channel's side of the connection between the
+// two channels is locked
+func IsLocked(sourceChannelID, targetChannelID string) bool {
+	if IsChannelLocked(targetChannelID) {
+		return true
+	}
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM connection
+		WHERE (first_channel_id = $1 AND second_channel_id = $2 AND second_channel_locked)
+		   OR (first_channel_id = $2 AND second_channel_id = $1 AND first_channel_locked)
+	`, sourceChannelID, targetChannelID).Scan(&count)
+	if err != nil {
+		log.Println("[database][IsLocked] err:", err.Error())
+	}
+	return count > 0
+}
+
+// LockConnection locks or unlocks the channel's side of its connections with the other channel, which prevents
+// messages from the other channel from being proxied to the channel until it is unlocked
+func LockConnection(channelID, otherChannelID string, unlock bool) error {
+	result, err := db.Exec("UPDATE connection SET first_channel_locked = $1 WHERE first_channel_id = $2 AND second_channel_id = $3", !unlock, channelID, otherChannelID)
 	if err != nil {
 		return err
 	}
-	_, err = db.Exec("DELETE FROM connection WHERE first_channel_id IN ($1, $2) AND second_channel_id IN ($1, $2)", channelID, otherChannelID)
-	return err
+	firstRowsAffected, _ := result.RowsAffected()
+	if result, err = db.Exec("UPDATE connection SET second_channel_locked = $1 WHERE first_channel_id = $3 AND second_channel_id = $2", !unlock, channelID, otherChannelID); err != nil {
+		return err
+	}
+	if secondRowsAffected, _ := result.RowsAffected(); firstRowsAffected+secondRowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// IsConnectionLocked checks whether the channel's side of its connection with the other channel is locked
+func IsConnectionLocked(channelID, otherChannelID string) bool {
+	var count int
+	_ = db.QueryRow(`
+		SELECT COUNT(*) FROM connection
+		WHERE (first_channel_id = $1 AND second_channel_id = $2 AND first_channel_locked)
+		   OR (first_channel_id = $2 AND second_channel_id = $1 AND second_channel_locked)
+	`, channelID, otherChannelID).Scan(&count)
+	return count > 0
+}
+
+// DeleteConnection deletes the connection through which messages are proxied from both channels passed as parameter,
+// or returns ErrNotFound if there is no such connection
+func DeleteConnection(channelID, otherChannelID string) error {
+	result, err := db.Exec("DELETE FROM connection WHERE first_channel_id IN ($1, $2) AND second_channel_id IN ($1, $2) AND direction = 'both'", channelID, otherChannelID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return deleteBindingState(channelID, otherChannelID)
+}
+
+// deleteBindingState deletes the filter rules, mutes, lock timers, held messages, pending reviews and rate limits of the
+// binding between two channels, unless messages are still proxied between them through another connection or a hub
+func deleteBindingState(channelID, otherChannelID string) error {
+	linkedChannelIDs, err := GetLinkedChannelIDs(channelID)
+	if err != nil {
+		return err
+	}
+	for _, linkedChannelID := range linkedChannelIDs {
+		if linkedChannelID == otherChannelID {
+			return nil
+		}
+	}
+	statements := []string{
+		"DELETE FROM filter_rule WHERE (channel_id = $1 AND other_channel_id = $2) OR (channel_id = $2 AND other_channel_id = $1)",
+		"DELETE FROM bridge_mute WHERE (channel_id = $1 AND other_channel_id = $2) OR (channel_id = $2 AND other_channel_id = $1)",
+		"DELETE FROM lock_timer WHERE (channel_id = $1 AND other_channel_id = $2) OR (channel_id = $2 AND other_channel_id = $1)",
+		"DELETE FROM held_message WHERE (source_channel_id = $1 AND target_channel_id = $2) OR (source_channel_id = $2 AND target_channel_id = $1)",
+		"DELETE FROM review WHERE (source_channel_id = $1 AND target_channel_id = $2) OR (source_channel_id = $2 AND target_channel_id = $1)",
+		"DELETE FROM rate_limit WHERE (channel_id = $1 AND other_channel_id = $2) OR (channel_id = $2 AND other_channel_id = $1)",
+	}
+	for _, statement := range statements {
+		if _, err = db.Exec(statement, channelID, otherChannelID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetSubscriberChannelIDs returns the IDs of the channels subscribed to the publisher channel passed as parameter
+func GetSubscriberChannelIDs(publisherChannelID string) ([]string, error) {
+	return queryChannelIDs("SELECT second_channel_id FROM connection WHERE first_channel_id = $1 AND direction = 'one-way'", publisherChannelID)
+}
+
+// GetPublisherChannelIDs returns the IDs of the channels the subscriber channel passed as parameter is subscribed to
+func GetPublisherChannelIDs(subscriberChannelID string) ([]string, error) {
+	return queryChannelIDs("SELECT first_channel_id FROM connection WHERE second_channel_id = $1 AND direction = 'one-way'", subscriberChannelID)
+}
+
+// DeleteOneWayConnection deletes the one-way connection between a publisher and a subscriber, or returns ErrNotFound
+// if there is no such connection
+func DeleteOneWayConnection(publisherChannelID, subscriberChannelID string) error {
+	result, err := db.Exec("DELETE FROM connection WHERE first_channel_id = $1 AND second_channel_id = $2 AND direction = 'one-way'", publisherChannelID, subscriberChannelID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return deleteBindingState(publisherChannelID, subscriberChannelID)
+}
+
+// GetTargetChannelIDs returns the IDs of all channels that messages sent in the channel passed as parameter must be
+// proxied to, which includes the channels it's connected to, its subscribers, as well as the other members of the hub
+// it's a member of
+func GetTargetChannelIDs(channelID string) ([]string, error) {
+	subscriberChannelIDs, err := GetSubscriberChannelIDs(channelID)
+	if err != nil {
+		return nil, err
+	}
+	return getChannelIDsProxiedFromBothWays(channelID, subscriberChannelIDs)
+}
+
+// GetSourceChannelIDs returns the IDs of all channels whose messages are proxied to the channel passed as parameter,
+// which includes the channels it's connected to, the channels it is subscribed to, as well as the other members of the
+// hub it's a member of
+func GetSourceChannelIDs(channelID string) ([]string, error) {
+	publisherChannelIDs, err := GetPublisherChannelIDs(channelID)
+	if err != nil {
+		return nil, err
+	}
+	return getChannelIDsProxiedFromBothWays(channelID, publisherChannelIDs)
+}
+
+// GetLinkedChannelIDs returns the IDs of all channels messages are proxied to or from the channel passed as parameter,
+// regardless of the type of connection, without duplicates
+func GetLinkedChannelIDs(channelID string) ([]string, error) {
+	subscriberChannelIDs, err := GetSubscriberChannelIDs(channelID)
+	if err != nil {
+		return nil, err
+	}
+	publisherChannelIDs, err := GetPublisherChannelIDs(channelID)
+	if err != nil {
+		return nil, err
+	}
+	return getChannelIDsProxiedFromBothWays(channelID, append(subscriberChannelIDs, publisherChannelIDs...))
+}
+
+// getChannelIDsProxiedFromBothWays returns the IDs of the channels connected to the channel passed as parameter and
+// of the other members of its hub, in addition to the channel IDs passed as parameter, without duplicates
+func getChannelIDsProxiedFromBothWays(channelID string, channelIDs []string) ([]string, error) {
+	connectedChannelIDs, err := GetConnectedChannelIDs(channelID)
+	if err != nil {
+		return nil, err
+	}
+	channelIDs = append(channelIDs, connectedChannelIDs...)
+	hubName, err := GetHubNameByChannelID(channelID)
+	if err == nil {
+		hubChannelIDs, err := GetHubChannelIDs(hubName)
+		if err != nil {
+			return nil, err
+		}
+		channelIDs = append(channelIDs, hubChannelIDs...)
+	} else if err != ErrNotFound {
+		return nil, err
+	}
+	var uniqueChannelIDs []string
+	seen := map[string]bool{channelID: true}
+	for _, id := range channelIDs {
+		if !seen[id] {
+			seen[id] = true
+			uniqueChannelIDs = append(uniqueChannelIDs, id)
+		}
+	}
+	return uniqueChannelIDs, nil
+}
+
+func queryChannelIDs(query string, args ...interface{}) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var channelIDs []string
+	for rows.Next() {
+		var channelID string
+		if err = rows.Scan(&channelID); err != nil {
+			break
+		}
+		channelIDs = append(channelIDs, channelID)
+	}
+	_ = rows.Close()
+	return channelIDs, err
 }
 
 func createChannel(channelID string) error {
-	_, err := db.Exec("INSERT INTO channel (channel_id) VALUES ($1)", channelID)
+	// The channel may already exist if it was part of a connection or of a hub in the past
+	_, err := db.Exec("INSERT OR IGNORE INTO channel (channel_id) VALUES ($1)", channelID)
 	return err
 }
@@ -0,0 +1,127 @@
+package database
+
+import "time"
+
+// FilterRule is a rule that is checked against the content of the messages proxied through a connection, in both
+// directions
+type FilterRule struct {
+	ID             int64
+	ChannelID      string
+	OtherChannelID string
+
+	// Type is how Pattern is matched against the content of a message, which is either "word", "glob" or "regex"
+	Type    string
+	Pattern string
+
+	// Action is what happens to a message that matches the rule, which is either "block", "redact" or "hold"
+	Action string
+
+	CreatedAt time.Time
+}
+
+// BlockedMessage is a message that was not proxied to a channel because it matched a filter rule
+type BlockedMessage struct {
+	SourceChannelID string
+	SourceMessageID string
+	TargetChannelID string
+	AuthorID        string
+	FilterRuleID    int64
+	Reason          string
+	CreatedAt       time.Time
+}
+
+// CreateFilterRule creates a filter rule and sets the ID of the rule passed as parameter
+func CreateFilterRule(rule *FilterRule) error {
+	result, err := db.Exec(
+		"INSERT INTO filter_rule (channel_id, other_channel_id, rule_type, pattern, action, created_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		rule.ChannelID,
+		rule.OtherChannelID,
+		rule.Type,
+		rule.Pattern,
+		rule.Action,
+		rule.CreatedAt.Unix(),
+	)
+	if err != nil {
+		return err
+	}
+	rule.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetFilterRules returns the filter rules of the connection between the two channels passed as parameter, regardless
+// of which of the two channels they were created from
+func GetFilterRules(channelID, otherChannelID string) ([]*FilterRule, error) {
+	rows, err := db.Query(`
+		SELECT filter_rule_id, channel_id, other_channel_id, rule_type, pattern, action, created_at FROM filter_rule
+		WHERE (channel_id = $1 AND other_channel_id = $2) OR (channel_id = $2 AND other_channel_id = $1)
+		ORDER BY filter_rule_id
+	`, channelID, otherChannelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var rules []*FilterRule
+	for rows.Next() {
+		rule := &FilterRule{}
+		var createdAt int64
+		if err = rows.Scan(&rule.ID, &rule.ChannelID, &rule.OtherChannelID, &rule.Type, &rule.Pattern, &rule.Action, &createdAt); err != nil {
+			return nil, err
+		}
+		rule.CreatedAt = time.Unix(createdAt, 0)
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// DeleteFilterRule deletes a filter rule created from the channel passed as parameter, or returns ErrNotFound if the
+// channel has no such rule. Rules created from the other channel of the connection can't be deleted this way.
+func DeleteFilterRule(channelID string, id int64) error {
+	result, err := db.Exec("DELETE FROM filter_rule WHERE filter_rule_id = $1 AND channel_id = $2", id, channelID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// CreateBlockedMessage keeps track of a message that was blocked by a filter rule, along with the reason why
+func CreateBlockedMessage(blockedMessage *BlockedMessage) error {
+	_, err := db.Exec(
+		"INSERT INTO blocked_message (source_channel_id, source_message_id, target_channel_id, author_id, filter_rule_id, reason, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		blockedMessage.SourceChannelID,
+		blockedMessage.SourceMessageID,
+		blockedMessage.TargetChannelID,
+		blockedMessage.AuthorID,
+		blockedMessage.FilterRuleID,
+		blockedMessage.Reason,
+		blockedMessage.CreatedAt.Unix(),
+	)
+	return err
+}
+
+// GetBlockedMessages returns the most recent messages that were blocked from being proxied from or to the channel
+// passed as parameter, starting with the most recent one
+func GetBlockedMessages(channelID string, limit int) ([]*BlockedMessage, error) {
+	rows, err := db.Query(`
+		SELECT source_channel_id, source_message_id, target_channel_id, author_id, filter_rule_id, reason, created_at FROM blocked_message
+		WHERE source_channel_id = $1 OR target_channel_id = $1
+		ORDER BY blocked_message_id DESC LIMIT $2
+	`, channelID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var blockedMessages []*BlockedMessage
+	for rows.Next() {
+		blockedMessage := &BlockedMessage{}
+		var createdAt int64
+		if err = rows.Scan(&blockedMessage.SourceChannelID, &blockedMessage.SourceMessageID, &blockedMessage.TargetChannelID, &blockedMessage.AuthorID, &blockedMessage.FilterRuleID, &blockedMessage.Reason, &createdAt); err != nil {
+			return nil, err
+		}
+		blockedMessage.CreatedAt = time.Unix(createdAt, 0)
+		blockedMessages = append(blockedMessages, blockedMessage)
+	}
+	return blockedMessages, rows.Err()
+}
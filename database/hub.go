@@ -0,0 +1,102 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrHubAlreadyExists = errors.New("a hub with this name already exists")
+	ErrAlreadyInHub     = errors.New("channel is already a member of a hub")
+	ErrNotInHub         = errors.New("channel is not a member of any hub")
+)
+
+// CreateHub creates a hub and adds the channel passed as parameter to it
+func CreateHub(hubName, channelID string) error {
+	if _, err := GetHubNameByChannelID(channelID); err == nil {
+		return ErrAlreadyInHub
+	}
+	if _, err := db.Exec("INSERT INTO hub (hub_name) VALUES ($1)", hubName); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return ErrHubAlreadyExists
+		}
+		return err
+	}
+	return JoinHub(hubName, channelID)
+}
+
+// JoinHub adds a channel to an existing hub, or returns ErrNotFound if there is no hub with the name passed as parameter
+func JoinHub(hubName, channelID string) error {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM hub WHERE hub_name = $1", hubName).Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	if _, err := GetHubNameByChannelID(channelID); err == nil {
+		return ErrAlreadyInHub
+	}
+	if err := createChannel(channelID); err != nil {
+		return err
+	}
+	_, err := db.Exec("INSERT INTO hub_channel (hub_name, channel_id) VALUES ($1, $2)", hubName, channelID)
+	return err
+}
+
+// LeaveHub removes a channel from the hub it's a member of.
+// If the channel was the last member of the hub, the hub is deleted.
+func LeaveHub(channelID string) error {
+	hubName, err := GetHubNameByChannelID(channelID)
+	if err != nil {
+		if err == ErrNotFound {
+			return ErrNotInHub
+		}
+		return err
+	}
+	if _, err = db.Exec("DELETE FROM hub_channel WHERE channel_id = $1", channelID); err != nil {
+		return err
+	}
+	if _, err = db.Exec("DELETE FROM hub WHERE hub_name = $1 AND NOT EXISTS (SELECT 1 FROM hub_channel WHERE hub_name = $1)", hubName); err != nil {
+		return err
+	}
+	otherChannelIDs, err := GetHubChannelIDs(hubName)
+	if err != nil {
+		return err
+	}
+	for _, otherChannelID := range otherChannelIDs {
+		if err = deleteBindingState(channelID, otherChannelID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetHubNameByChannelID returns the name of the hub a channel is a member of, or returns ErrNotFound if the channel
+// isn't a member of any hub
+func GetHubNameByChannelID(channelID string) (hubName string, err error) {
+	err = db.QueryRow("SELECT hub_name FROM hub_channel WHERE channel_id = $1", channelID).Scan(&hubName)
+	if err == sql.ErrNoRows {
+		err = ErrNotFound
+	}
+	return
+}
+
+// GetHubChannelIDs returns the IDs of all channels that are members of a hub
+func GetHubChannelIDs(hubName string) ([]string, error) {
+	return queryChannelIDs("SELECT channel_id FROM hub_channel WHERE hub_name = $1 ORDER BY rowid", hubName)
+}
+
+// SetHubChannelAllowedMentions sets the types of mentions that are allowed in messages proxied to a channel from the
+// other members of its hub
+func SetHubChannelAllowedMentions(channelID string, allowedMentions []string) error {
+	result, err := db.Exec("UPDATE hub_channel SET allowed_mentions = $1 WHERE channel_id = $2", strings.Join(allowedMentions, ","), channelID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrNotInHub
+	}
+	return nil
+}
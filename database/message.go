@@ -0,0 +1,93 @@
+package database
+
+import "database/sql"
+
+// ProxiedMessage is a copy of a message from a source channel that has been proxied to another channel
+type ProxiedMessage struct {
+	SourceChannelID string
+	SourceMessageID string
+	ProxyChannelID  string
+	ProxyMessageID  string
+
+	// WebhookID is the ID of the webhook through which the message was proxied, or an empty string if the message
+	// was sent by the bot itself
+	WebhookID string
+
+	// Part is the index of the copy among the copies in the same channel, since a message that's too long has to be
+	// split into several messages
+	Part int
+}
+
+// CreateProxiedMessage keeps track of a message that has been proxied, so that the changes made to the source message
+// can be applied to its copy
+func CreateProxiedMessage(proxiedMessage *ProxiedMessage) error {
+	_, err := db.Exec(
+		"INSERT INTO proxied_message (source_channel_id, source_message_id, proxy_channel_id, proxy_message_id, webhook_id, part) VALUES ($1, $2, $3, $4, $5, $6)",
+		proxiedMessage.SourceChannelID,
+		proxiedMessage.SourceMessageID,
+		proxiedMessage.ProxyChannelID,
+		proxiedMessage.ProxyMessageID,
+		proxiedMessage.WebhookID,
+		proxiedMessage.Part,
+	)
+	return err
+}
+
+// GetProxiedMessagesBySourceMessageID returns all copies of the message passed as parameter, ordered by channel and
+// by part
+func GetProxiedMessagesBySourceMessageID(sourceMessageID string) ([]*ProxiedMessage, error) {
+	rows, err := db.Query("SELECT source_channel_id, source_message_id, proxy_channel_id, proxy_message_id, webhook_id, part FROM proxied_message WHERE source_message_id = $1 ORDER BY proxy_channel_id, part", sourceMessageID)
+	if err != nil {
+		return nil, err
+	}
+	var proxiedMessages []*ProxiedMessage
+	for rows.Next() {
+		proxiedMessage := &ProxiedMessage{}
+		if err = rows.Scan(&proxiedMessage.SourceChannelID, &proxiedMessage.SourceMessageID, &proxiedMessage.ProxyChannelID, &proxiedMessage.ProxyMessageID, &proxiedMessage.WebhookID, &proxiedMessage.Part); err != nil {
+			break
+		}
+		proxiedMessages = append(proxiedMessages, proxiedMessage)
+	}
+	_ = rows.Close()
+	return proxiedMessages, err
+}
+
+// GetProxiedMessageByProxyMessageID returns the proxied message whose copy has the ID passed as parameter, or returns
+// ErrNotFound if the message passed as parameter is not a copy
+func GetProxiedMessageByProxyMessageID(proxyMessageID string) (*ProxiedMessage, error) {
+	proxiedMessage := &ProxiedMessage{}
+	err := db.QueryRow("SELECT source_channel_id, source_message_id, proxy_channel_id, proxy_message_id, webhook_id, part FROM proxied_message WHERE proxy_message_id = $1", proxyMessageID).
+		Scan(&proxiedMessage.SourceChannelID, &proxiedMessage.SourceMessageID, &proxiedMessage.ProxyChannelID, &proxiedMessage.ProxyMessageID, &proxiedMessage.WebhookID, &proxiedMessage.Part)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return proxiedMessage, err
+}
+
+// DeleteProxiedMessagesBySourceMessageID forgets about all copies of the message passed as parameter
+func DeleteProxiedMessagesBySourceMessageID(sourceMessageID string) error {
+	_, err := db.Exec("DELETE FROM proxied_message WHERE source_message_id = $1", sourceMessageID)
+	return err
+}
+
+// DeleteProxiedMessageByProxyMessageID forgets about a copy of a message
+func DeleteProxiedMessageByProxyMessageID(proxyMessageID string) error {
+	_, err := db.Exec("DELETE FROM proxied_message WHERE proxy_message_id = $1", proxyMessageID)
+	return err
+}
+
+// IsMessageProxiedToChannel checks whether a message has already been proxied to the channel passed as parameter
+func IsMessageProxiedToChannel(sourceMessageID, channelID string) bool {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM proxied_message WHERE source_message_id = $1 AND proxy_channel_id = $2", sourceMessageID, channelID).Scan(&count); err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// CountProxiedMessages returns the number of messages that have been proxied from the source channel to the proxy
+// channel. Messages that had to be split into several messages are only counted once.
+func CountProxiedMessages(sourceChannelID, proxyChannelID string) (count int, err error) {
+	err = db.QueryRow("SELECT COUNT(*) FROM proxied_message WHERE source_channel_id = $1 AND proxy_channel_id = $2 AND part = 0", sourceChannelID, proxyChannelID).Scan(&count)
+	return
+}
@@ -0,0 +1,122 @@
+package database
+
+import "time"
+
+// BridgeMute prevents the messages of a user from being proxied through a connection, in both directions
+type BridgeMute struct {
+	// ChannelID is the channel from which the user was muted, and OtherChannelID is the other channel of the connection
+	ChannelID      string
+	OtherChannelID string
+
+	UserID string
+
+	// Banned is whether the user is banned from the connection, in which case the mute never expires
+	Banned bool
+
+	// ExpiresAt is when the mute expires, or the zero time if it doesn't expire
+	ExpiresAt time.Time
+
+	// Notified is whether the user has been told that their messages are not being proxied
+	Notified bool
+
+	CreatedAt time.Time
+}
+
+// SetBridgeMute mutes or bans a user from a connection, replacing the previous mute of the user from the same channel
+// if there was one
+func SetBridgeMute(mute *BridgeMute) error {
+	var expiresAt int64
+	if !mute.ExpiresAt.IsZero() {
+		expiresAt = mute.ExpiresAt.Unix()
+	}
+	_, err := db.Exec(
+		"INSERT OR REPLACE INTO bridge_mute (channel_id, other_channel_id, user_id, banned, expires_at, notified, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		mute.ChannelID,
+		mute.OtherChannelID,
+		mute.UserID,
+		mute.Banned,
+		expiresAt,
+		mute.Notified,
+		mute.CreatedAt.Unix(),
+	)
+	return err
+}
+
+// GetBridgeMute returns the mute that prevents the messages of a user from being proxied from the source channel to the
+// target channel, giving precedence to bans, or returns ErrNotFound if the user isn't muted from their connection
+func GetBridgeMute(sourceChannelID, targetChannelID, userID string) (*BridgeMute, error) {
+	mutes, err := queryBridgeMutes(`
+		SELECT channel_id, other_channel_id, user_id, banned, expires_at, notified, created_at FROM bridge_mute
+		WHERE ((channel_id = $1 AND other_channel_id = $2) OR (channel_id = $2 AND other_channel_id = $1)) AND user_id = $3 AND (expires_at = 0 OR expires_at > $4)
+		ORDER BY banned DESC, expires_at = 0 DESC, expires_at DESC
+	`, sourceChannelID, targetChannelID, userID, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	if len(mutes) == 0 {
+		return nil, ErrNotFound
+	}
+	return mutes[0], nil
+}
+
+// GetBridgeMutesByChannelID returns the mutes that haven't expired yet of all connections of a channel, regardless of
+// which channel of the connection they were created from
+func GetBridgeMutesByChannelID(channelID string) ([]*BridgeMute, error) {
+	return queryBridgeMutes(`
+		SELECT channel_id, other_channel_id, user_id, banned, expires_at, notified, created_at FROM bridge_mute
+		WHERE (channel_id = $1 OR other_channel_id = $1) AND (expires_at = 0 OR expires_at > $2)
+		ORDER BY created_at
+	`, channelID, time.Now().Unix())
+}
+
+// SetBridgeMuteNotified marks the mute of a user as notified, so that the user is only told once that their messages
+// are not being proxied
+func SetBridgeMuteNotified(mute *BridgeMute) error {
+	_, err := db.Exec("UPDATE bridge_mute SET notified = TRUE WHERE channel_id = $1 AND other_channel_id = $2 AND user_id = $3", mute.ChannelID, mute.OtherChannelID, mute.UserID)
+	return err
+}
+
+// DeleteBridgeMute unmutes or unbans a user from a connection, or returns ErrNotFound if the user wasn't muted from the
+// channel passed as parameter
+func DeleteBridgeMute(channelID, otherChannelID, userID string) error {
+	result, err := db.Exec("DELETE FROM bridge_mute WHERE channel_id = $1 AND other_channel_id = $2 AND user_id = $3 AND (expires_at = 0 OR expires_at > $4)", channelID, otherChannelID, userID, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteExpiredBridgeMutes deletes all mutes that expired before the time passed as parameter and returns them
+func DeleteExpiredBridgeMutes(now time.Time) ([]*BridgeMute, error) {
+	mutes, err := queryBridgeMutes("SELECT channel_id, other_channel_id, user_id, banned, expires_at, notified, created_at FROM bridge_mute WHERE expires_at != 0 AND expires_at <= $1", now.Unix())
+	if err != nil || len(mutes) == 0 {
+		return mutes, err
+	}
+	_, err = db.Exec("DELETE FROM bridge_mute WHERE expires_at != 0 AND expires_at <= $1", now.Unix())
+	return mutes, err
+}
+
+func queryBridgeMutes(query string, args ...interface{}) ([]*BridgeMute, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var mutes []*BridgeMute
+	for rows.Next() {
+		mute := &BridgeMute{}
+		var expiresAt, createdAt int64
+		if err = rows.Scan(&mute.ChannelID, &mute.OtherChannelID, &mute.UserID, &mute.Banned, &expiresAt, &mute.Notified, &createdAt); err != nil {
+			return nil, err
+		}
+		if expiresAt != 0 {
+			mute.ExpiresAt = time.Unix(expiresAt, 0)
+		}
+		mute.CreatedAt = time.Unix(createdAt, 0)
+		mutes = append(mutes, mute)
+	}
+	return mutes, rows.Err()
+}
@@ -0,0 +1,44 @@
+package database
+
+import "database/sql"
+
+// GetCommandRoleID returns the ID of the role required to use a command in a guild, or returns ErrNotFound if no role
+// has been configured for that command, in which case the default permission requirements apply
+func GetCommandRoleID(guildID, command string) (roleID string, err error) {
+	err = db.QueryRow("SELECT role_id FROM command_role WHERE guild_id = $1 AND command = $2", guildID, command).Scan(&roleID)
+	if err == sql.ErrNoRows {
+		err = ErrNotFound
+	}
+	return
+}
+
+// GetCommandRoleIDs returns the ID of the role required to use each command that has one in a guild, by command
+func GetCommandRoleIDs(guildID string) (map[string]string, error) {
+	rows, err := db.Query("SELECT command, role_id FROM command_role WHERE guild_id = $1 ORDER BY command", guildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	roleIDs := make(map[string]string)
+	for rows.Next() {
+		var command, roleID string
+		if err = rows.Scan(&command, &roleID); err != nil {
+			return nil, err
+		}
+		roleIDs[command] = roleID
+	}
+	return roleIDs, rows.Err()
+}
+
+// SetCommandRoleID sets the role required to use a command in a guild, replacing the previous one if there was one
+func SetCommandRoleID(guildID, command, roleID string) error {
+	_, err := db.Exec("INSERT OR REPLACE INTO command_role (guild_id, command, role_id) VALUES ($1, $2, $3)", guildID, command, roleID)
+	return err
+}
+
+// DeleteCommandRoleID removes the role required to use a command in a guild, which restores the default permission
+// requirements
+func DeleteCommandRoleID(guildID, command string) error {
+	_, err := db.Exec("DELETE FROM command_role WHERE guild_id = $1 AND command = $2", guildID, command)
+	return err
+}
@@ -0,0 +1,66 @@
+package database
+
+import "time"
+
+// HeldMessage is a message that has not been proxied to a channel yet because that channel was locked when the message
+// was sent. Only the IDs are kept, since the message may be edited before it's proxied.
+type HeldMessage struct {
+	ID              int64
+	SourceChannelID string
+	SourceMessageID string
+	TargetChannelID string
+	CreatedAt       time.Time
+}
+
+// HoldMessage adds a message to the queue of messages waiting to be proxied to the target channel
+func HoldMessage(heldMessage *HeldMessage) error {
+	_, err := db.Exec(
+		"INSERT OR IGNORE INTO held_message (source_channel_id, source_message_id, target_channel_id, created_at) VALUES ($1, $2, $3, $4)",
+		heldMessage.SourceChannelID,
+		heldMessage.SourceMessageID,
+		heldMessage.TargetChannelID,
+		heldMessage.CreatedAt.Unix(),
+	)
+	return err
+}
+
+// GetHeldMessages returns the messages waiting to be proxied to the channel passed as parameter, in the order in which
+// they were sent
+func GetHeldMessages(targetChannelID string) ([]*HeldMessage, error) {
+	rows, err := db.Query("SELECT held_message_id, source_channel_id, source_message_id, target_channel_id, created_at FROM held_message WHERE target_channel_id = $1 ORDER BY held_message_id", targetChannelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var heldMessages []*HeldMessage
+	for rows.Next() {
+		heldMessage := &HeldMessage{}
+		var createdAt int64
+		if err = rows.Scan(&heldMessage.ID, &heldMessage.SourceChannelID, &heldMessage.SourceMessageID, &heldMessage.TargetChannelID, &createdAt); err != nil {
+			return nil, err
+		}
+		heldMessage.CreatedAt = time.Unix(createdAt, 0)
+		heldMessages = append(heldMessages, heldMessage)
+	}
+	return heldMessages, rows.Err()
+}
+
+// DeleteHeldMessage removes a message from the queue of the channel it was waiting to be proxied to
+func DeleteHeldMessage(id int64) error {
+	_, err := db.Exec("DELETE FROM held_message WHERE held_message_id = $1", id)
+	return err
+}
+
+// DeleteHeldMessagesBySourceMessageID removes a message from the queues of all channels it was waiting to be
+// proxied to, which is necessary when the message is deleted
+func DeleteHeldMessagesBySourceMessageID(sourceMessageID string) error {
+	_, err := db.Exec("DELETE FROM held_message WHERE source_message_id = $1", sourceMessageID)
+	return err
+}
+
+// DeleteHeldMessageBySourceMessageID removes a message from the queue of a channel, which is necessary when the message
+// is proxied to that channel by other means
+func DeleteHeldMessageBySourceMessageID(sourceMessageID, targetChannelID string) error {
+	_, err := db.Exec("DELETE FROM held_message WHERE source_message_id = $1 AND target_channel_id = $2", sourceMessageID, targetChannelID)
+	return err
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// RateLimit is how many messages can be proxied to a channel from another channel over a period of time, which is set
+// by the channel the messages are proxied to
+type RateLimit struct {
+	ChannelID      string
+	OtherChannelID string
+
+	// UserMessages is how many messages each user can send per UserPeriod, or 0 if users aren't limited
+	UserMessages int
+	UserPeriod   time.Duration
+
+	// BindingMessages is how many messages can be proxied from the other channel per BindingPeriod, or 0 if the binding
+	// isn't limited
+	BindingMessages int
+	BindingPeriod   time.Duration
+
+	// Delay is whether messages over the limit are delayed until they can be proxied, rather than dropped
+	Delay bool
+}
+
+// GetRateLimit returns the rate limit set by a channel on the messages proxied to it from the other channel, or returns
+// ErrNotFound if the channel has set none
+func GetRateLimit(channelID, otherChannelID string) (*RateLimit, error) {
+	rateLimit := &RateLimit{ChannelID: channelID, OtherChannelID: otherChannelID}
+	var userPeriodSeconds, bindingPeriodSeconds int64
+	err := db.QueryRow(
+		"SELECT user_messages, user_period_seconds, binding_messages, binding_period_seconds, delay FROM rate_limit WHERE channel_id = $1 AND other_channel_id = $2",
+		channelID,
+		otherChannelID,
+	).Scan(&rateLimit.UserMessages, &userPeriodSeconds, &rateLimit.BindingMessages, &bindingPeriodSeconds, &rateLimit.Delay)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	rateLimit.UserPeriod = time.Duration(userPeriodSeconds) * time.Second
+	rateLimit.BindingPeriod = time.Duration(bindingPeriodSeconds) * time.Second
+	return rateLimit, nil
+}
+
+// SetRateLimit sets the rate limit of a channel on the messages proxied to it from the other channel, replacing the
+// previous one if there was one
+func SetRateLimit(rateLimit *RateLimit) error {
+	_, err := db.Exec(
+		"INSERT OR REPLACE INTO rate_limit (channel_id, other_channel_id, user_messages, user_period_seconds, binding_messages, binding_period_seconds, delay) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		rateLimit.ChannelID,
+		rateLimit.OtherChannelID,
+		rateLimit.UserMessages,
+		int64(rateLimit.UserPeriod/time.Second),
+		rateLimit.BindingMessages,
+		int64(rateLimit.BindingPeriod/time.Second),
+		rateLimit.Delay,
+	)
+	return err
+}
+
+// DeleteRateLimit deletes the rate limit of a channel on the messages proxied to it from the other channel, or returns
+// ErrNotFound if the channel has set none
+func DeleteRateLimit(channelID, otherChannelID string) error {
+	result, err := db.Exec("DELETE FROM rate_limit WHERE channel_id = $1 AND other_channel_id = $2", channelID, otherChannelID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"time"
+)
+
+const (
+	RequestTypeBind      = "bind"
+	RequestTypePublish   = "publish"
+	RequestTypeSubscribe = "subscribe"
+	RequestTypeHubJoin   = "hub"
+	RequestTypeHubInvite = "hub-invite"
+)
+
+// BindRequest is a request sent from a channel to another channel to create a connection between them, which must be
+// answered by the other channel before it expires
+type BindRequest struct {
+	// Type is the type of the request, which is either RequestTypeBind, RequestTypePublish, RequestTypeSubscribe,
+	// RequestTypeHubJoin or RequestTypeHubInvite
+	Type string
+
+	FromChannelID string
+
+	// ToChannelID is the channel that must answer the request. Requests to join a hub are sent to every member of the
+	// hub, any of which can answer it.
+	ToChannelID string
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// CreateBindRequest stores a request, replacing the previous request of the same type between the same channels if
+// there was one
+func CreateBindRequest(request *BindRequest) error {
+	_, err := db.Exec(
+		"INSERT OR REPLACE INTO bind_request (request_type, from_channel_id, to_channel_id, created_at, expires_at) VALUES ($1, $2, $3, $4, $5)",
+		request.Type,
+		request.FromChannelID,
+		request.ToChannelID,
+		request.CreatedAt.Unix(),
+		request.ExpiresAt.Unix(),
+	)
+	return err
+}
+
+// ConsumeBindRequest deletes a request that has not expired yet, or returns ErrNotFound if there is no such request
+func ConsumeBindRequest(requestType, fromChannelID, toChannelID string) error {
+	result, err := db.Exec(
+		"DELETE FROM bind_request WHERE request_type = $1 AND from_channel_id = $2 AND to_channel_id = $3 AND expires_at > $4",
+		requestType,
+		fromChannelID,
+		toChannelID,
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetBindRequestsByChannelID returns all requests sent from or to the channel passed as parameter, ordered by
+// expiration date
+func GetBindRequestsByChannelID(channelID string) ([]*BindRequest, error) {
+	return queryBindRequests("SELECT request_type, from_channel_id, to_channel_id, created_at, expires_at FROM bind_request WHERE from_channel_id = $1 OR to_channel_id = $1 ORDER BY expires_at", channelID)
+}
+
+// DeleteBindRequestsFromChannel deletes all requests of a type sent from the channel passed as parameter, which is
+// necessary once a request sent to several channels has been answered by one of them
+func DeleteBindRequestsFromChannel(requestType, fromChannelID string) error {
+	_, err := db.Exec("DELETE FROM bind_request WHERE request_type = $1 AND from_channel_id = $2", requestType, fromChannelID)
+	return err
+}
+
+// DeleteBindRequestsBetweenChannels deletes all requests sent between two channels, regardless of their direction,
+// and returns the requests that were deleted
+func DeleteBindRequestsBetweenChannels(channelID, otherChannelID string) ([]*BindRequest, error) {
+	requests, err := queryBindRequests("SELECT request_type, from_channel_id, to_channel_id, created_at, expires_at FROM bind_request WHERE from_channel_id IN ($1, $2) AND to_channel_id IN ($1, $2)", channelID, otherChannelID)
+	if err != nil || len(requests) == 0 {
+		return requests, err
+	}
+	_, err = db.Exec("DELETE FROM bind_request WHERE from_channel_id IN ($1, $2) AND to_channel_id IN ($1, $2)", channelID, otherChannelID)
+	return requests, err
+}
+
+// DeleteExpiredBindRequests deletes all requests that expired before the time passed as parameter and returns them
+func DeleteExpiredBindRequests(now time.Time) ([]*BindRequest, error) {
+	requests, err := queryBindRequests("SELECT request_type, from_channel_id, to_channel_id, created_at, expires_at FROM bind_request WHERE expires_at <= $1", now.Unix())
+	if err != nil || len(requests) == 0 {
+		return requests, err
+	}
+	_, err = db.Exec("DELETE FROM bind_request WHERE expires_at <= $1", now.Unix())
+	return requests, err
+}
+
+func queryBindRequests(query string, args ...interface{}) ([]*BindRequest, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var requests []*BindRequest
+	for rows.Next() {
+		request := &BindRequest{}
+		var createdAt, expiresAt int64
+		if err = rows.Scan(&request.Type, &request.FromChannelID, &request.ToChannelID, &createdAt, &expiresAt); err != nil {
+			return nil, err
+		}
+		request.CreatedAt, request.ExpiresAt = time.Unix(createdAt, 0), time.Unix(expiresAt, 0)
+		requests = append(requests, request)
+	}
+	return requests, rows.Err()
+}
@@ -0,0 +1,66 @@
+package database
+
+import "time"
+
+// RetentionPolicy is how long messages are kept in a channel before being deleted automatically
+type RetentionPolicy struct {
+	ChannelID string
+	Retention time.Duration
+
+	// KeepPinned is whether pinned messages are excluded from the automatic deletion
+	KeepPinned bool
+}
+
+// GetRetentionPolicy returns the retention policy of a channel, or returns ErrNotFound if the channel has none
+func GetRetentionPolicy(channelID string) (*RetentionPolicy, error) {
+	policies, err := queryRetentionPolicies("SELECT channel_id, retention_seconds, keep_pinned FROM retention_policy WHERE channel_id = $1", channelID)
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) == 0 {
+		return nil, ErrNotFound
+	}
+	return policies[0], nil
+}
+
+// GetRetentionPolicies returns the retention policies of all channels
+func GetRetentionPolicies() ([]*RetentionPolicy, error) {
+	return queryRetentionPolicies("SELECT channel_id, retention_seconds, keep_pinned FROM retention_policy")
+}
+
+// SetRetentionPolicy sets the retention policy of a channel, replacing the previous one if there was one
+func SetRetentionPolicy(policy *RetentionPolicy) error {
+	_, err := db.Exec("INSERT OR REPLACE INTO retention_policy (channel_id, retention_seconds, keep_pinned) VALUES ($1, $2, $3)", policy.ChannelID, int64(policy.Retention/time.Second), policy.KeepPinned)
+	return err
+}
+
+// DeleteRetentionPolicy deletes the retention policy of a channel, or returns ErrNotFound if the channel has none
+func DeleteRetentionPolicy(channelID string) error {
+	result, err := db.Exec("DELETE FROM retention_policy WHERE channel_id = $1", channelID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func queryRetentionPolicies(query string, args ...interface{}) ([]*RetentionPolicy, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var policies []*RetentionPolicy
+	for rows.Next() {
+		policy := &RetentionPolicy{}
+		var retentionSeconds int64
+		if err = rows.Scan(&policy.ChannelID, &retentionSeconds, &policy.KeepPinned); err != nil {
+			return nil, err
+		}
+		policy.Retention = time.Duration(retentionSeconds) * time.Second
+		policies = append(policies, policy)
+	}
+	return policies, rows.Err()
+}
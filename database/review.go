@@ -0,0 +1,106 @@
+package database
+
+import "time"
+
+// Review is a message waiting to be approved or rejected by the moderators of the channel it would be proxied to
+type Review struct {
+	ReviewChannelID string
+	ReviewMessageID string
+	SourceChannelID string
+	SourceMessageID string
+	TargetChannelID string
+	CreatedAt       time.Time
+}
+
+// SetReviewChannelID sets the channel in which messages from the other channel must be approved before being proxied
+// to the channel, or disables the approval of these messages if reviewChannelID is empty
+func SetReviewChannelID(channelID, otherChannelID, reviewChannelID string) error {
+	result, err := db.Exec("UPDATE connection SET first_channel_review_channel_id = $1 WHERE first_channel_id = $2 AND second_channel_id = $3", reviewChannelID, channelID, otherChannelID)
+	if err != nil {
+		return err
+	}
+	firstRowsAffected, _ := result.RowsAffected()
+	if result, err = db.Exec("UPDATE connection SET second_channel_review_channel_id = $1 WHERE first_channel_id = $3 AND second_channel_id = $2", reviewChannelID, channelID, otherChannelID); err != nil {
+		return err
+	}
+	if secondRowsAffected, _ := result.RowsAffected(); firstRowsAffected+secondRowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetReviewChannelID returns the channel in which messages from the source channel must be approved before being
+// proxied to the target channel, or an empty string if they don't need to be approved
+func GetReviewChannelID(sourceChannelID, targetChannelID string) (reviewChannelID string) {
+	_ = db.QueryRow(`
+		SELECT second_channel_review_channel_id FROM connection WHERE first_channel_id = $1 AND second_channel_id = $2
+		UNION
+		SELECT first_channel_review_channel_id FROM connection WHERE first_channel_id = $2 AND second_channel_id = $1
+	`, sourceChannelID, targetChannelID).Scan(&reviewChannelID)
+	return
+}
+
+// CreateReview keeps track of a message that has been posted in a review channel
+func CreateReview(review *Review) error {
+	_, err := db.Exec(
+		"INSERT INTO review (review_channel_id, review_message_id, source_channel_id, source_message_id, target_channel_id, created_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		review.ReviewChannelID,
+		review.ReviewMessageID,
+		review.SourceChannelID,
+		review.SourceMessageID,
+		review.TargetChannelID,
+		review.CreatedAt.Unix(),
+	)
+	return err
+}
+
+// GetReviewByReviewMessageID returns the review posted as the message passed as parameter, or returns ErrNotFound if
+// the message isn't a review waiting for a decision
+func GetReviewByReviewMessageID(reviewMessageID string) (*Review, error) {
+	reviews, err := queryReviews("SELECT review_channel_id, review_message_id, source_channel_id, source_message_id, target_channel_id, created_at FROM review WHERE review_message_id = $1", reviewMessageID)
+	if err != nil {
+		return nil, err
+	}
+	if len(reviews) == 0 {
+		return nil, ErrNotFound
+	}
+	return reviews[0], nil
+}
+
+// GetReviewsBySourceMessageID returns the reviews of a message, of which there's one per channel that requires it to
+// be approved
+func GetReviewsBySourceMessageID(sourceMessageID string) ([]*Review, error) {
+	return queryReviews("SELECT review_channel_id, review_message_id, source_channel_id, source_message_id, target_channel_id, created_at FROM review WHERE source_message_id = $1", sourceMessageID)
+}
+
+// DeleteReview deletes a review, or returns ErrNotFound if it was already deleted, which means that another moderator
+// made a decision first
+func DeleteReview(reviewMessageID string) error {
+	result, err := db.Exec("DELETE FROM review WHERE review_message_id = $1", reviewMessageID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func queryReviews(query string, args ...interface{}) ([]*Review, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var reviews []*Review
+	for rows.Next() {
+		review := &Review{}
+		var createdAt int64
+		if err = rows.Scan(&review.ReviewChannelID, &review.ReviewMessageID, &review.SourceChannelID, &review.SourceMessageID, &review.TargetChannelID, &createdAt); err != nil {
+			return nil, err
+		}
+		review.CreatedAt = time.Unix(createdAt, 0)
+		reviews = append(reviews, review)
+	}
+	return reviews, rows.Err()
+}
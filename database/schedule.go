@@ -0,0 +1,159 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// LockTimer is a lock that must be lifted automatically at a given time
+type LockTimer struct {
+	ChannelID string
+
+	// OtherChannelID is the channel of the binding that is locked, or an empty string if the whole channel is locked
+	OtherChannelID string
+
+	UnlockAt time.Time
+
+	// Pull is whether the messages held while the lock was active must be pulled once it's lifted
+	Pull bool
+}
+
+// LockSchedule is a recurring schedule outside of which a channel is locked
+type LockSchedule struct {
+	ChannelID string
+
+	// StartMinute and EndMinute are the minutes of the day between which the channel is unlocked.
+	// If EndMinute is lower than StartMinute, the channel is unlocked past midnight.
+	StartMinute int
+	EndMinute   int
+
+	// Timezone is the name of the IANA time zone in which StartMinute and EndMinute are expressed (e.g. Europe/Paris)
+	Timezone string
+
+	// Weekdays is a bitmask of the days on which the channel is unlocked between StartMinute and EndMinute, where the
+	// bit of each day is 1 << time.Weekday. The channel is locked all day on the other days.
+	Weekdays int
+
+	// Pull is whether the messages held while the channel was locked must be pulled when it's unlocked
+	Pull bool
+
+	// Locked is whether the schedule last locked or unlocked the channel, so that the lock is only changed when the
+	// schedule changes state, which allows the channel to be locked or unlocked by hand in the meantime
+	Locked sql.NullBool
+}
+
+// SetLockTimer sets when a lock must be lifted, replacing the previous timer of the same lock if there was one
+func SetLockTimer(timer *LockTimer) error {
+	_, err := db.Exec(
+		"INSERT OR REPLACE INTO lock_timer (channel_id, other_channel_id, unlock_at, pull) VALUES ($1, $2, $3, $4)",
+		timer.ChannelID,
+		timer.OtherChannelID,
+		timer.UnlockAt.Unix(),
+		timer.Pull,
+	)
+	return err
+}
+
+// DeleteLockTimer deletes the timer of a lock, which makes the lock permanent until it is lifted by hand
+func DeleteLockTimer(channelID, otherChannelID string) error {
+	_, err := db.Exec("DELETE FROM lock_timer WHERE channel_id = $1 AND other_channel_id = $2", channelID, otherChannelID)
+	return err
+}
+
+// GetLockTimersByChannelID returns the timers of the locks of a channel, whether it's the channel itself or one of its
+// bindings that is locked
+func GetLockTimersByChannelID(channelID string) ([]*LockTimer, error) {
+	return queryLockTimers("SELECT channel_id, other_channel_id, unlock_at, pull FROM lock_timer WHERE channel_id = $1 ORDER BY unlock_at", channelID)
+}
+
+// GetExpiredLockTimers returns the timers of all locks that must be lifted before the time passed as parameter.
+// The timers are not deleted, so each of them must be deleted with DeleteLockTimer once its lock has been lifted.
+func GetExpiredLockTimers(now time.Time) ([]*LockTimer, error) {
+	return queryLockTimers("SELECT channel_id, other_channel_id, unlock_at, pull FROM lock_timer WHERE unlock_at <= $1", now.Unix())
+}
+
+func queryLockTimers(query string, args ...interface{}) ([]*LockTimer, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var timers []*LockTimer
+	for rows.Next() {
+		timer := &LockTimer{}
+		var unlockAt int64
+		if err = rows.Scan(&timer.ChannelID, &timer.OtherChannelID, &unlockAt, &timer.Pull); err != nil {
+			return nil, err
+		}
+		timer.UnlockAt = time.Unix(unlockAt, 0)
+		timers = append(timers, timer)
+	}
+	return timers, rows.Err()
+}
+
+// SetLockSchedule sets the lock schedule of a channel, replacing the previous one if there was one
+func SetLockSchedule(schedule *LockSchedule) error {
+	_, err := db.Exec(
+		"INSERT OR REPLACE INTO lock_schedule (channel_id, start_minute, end_minute, timezone, weekdays, pull, locked) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		schedule.ChannelID,
+		schedule.StartMinute,
+		schedule.EndMinute,
+		schedule.Timezone,
+		schedule.Weekdays,
+		schedule.Pull,
+		schedule.Locked,
+	)
+	return err
+}
+
+// SetLockScheduleState keeps track of whether a schedule last locked or unlocked its channel
+func SetLockScheduleState(channelID string, locked bool) error {
+	_, err := db.Exec("UPDATE lock_schedule SET locked = $1 WHERE channel_id = $2", locked, channelID)
+	return err
+}
+
+// GetLockSchedule returns the lock schedule of a channel, or returns ErrNotFound if the channel has none
+func GetLockSchedule(channelID string) (*LockSchedule, error) {
+	schedules, err := queryLockSchedules("SELECT channel_id, start_minute, end_minute, timezone, weekdays, pull, locked FROM lock_schedule WHERE channel_id = $1", channelID)
+	if err != nil {
+		return nil, err
+	}
+	if len(schedules) == 0 {
+		return nil, ErrNotFound
+	}
+	return schedules[0], nil
+}
+
+// GetLockSchedules returns the lock schedules of all channels
+func GetLockSchedules() ([]*LockSchedule, error) {
+	return queryLockSchedules("SELECT channel_id, start_minute, end_minute, timezone, weekdays, pull, locked FROM lock_schedule")
+}
+
+// DeleteLockSchedule deletes the lock schedule of a channel, or returns ErrNotFound if the channel has none
+func DeleteLockSchedule(channelID string) error {
+	result, err := db.Exec("DELETE FROM lock_schedule WHERE channel_id = $1", channelID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func queryLockSchedules(query string, args ...interface{}) ([]*LockSchedule, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var schedules []*LockSchedule
+	for rows.Next() {
+		schedule := &LockSchedule{}
+		if err = rows.Scan(&schedule.ChannelID, &schedule.StartMinute, &schedule.EndMinute, &schedule.Timezone, &schedule.Weekdays, &schedule.Pull, &schedule.Locked); err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, rows.Err()
+}
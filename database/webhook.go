@@ -0,0 +1,25 @@
+package database
+
+import "database/sql"
+
+// GetWebhook returns the ID and the token of the webhook used to proxy messages to the channel passed as parameter,
+// or returns ErrNotFound if no webhook has been stored for that channel
+func GetWebhook(channelID string) (webhookID, webhookToken string, err error) {
+	err = db.QueryRow("SELECT webhook_id, webhook_token FROM webhook WHERE channel_id = $1", channelID).Scan(&webhookID, &webhookToken)
+	if err == sql.ErrNoRows {
+		err = ErrNotFound
+	}
+	return
+}
+
+// SetWebhook stores the webhook used to proxy messages to a channel, replacing the previous one if there was one
+func SetWebhook(channelID, webhookID, webhookToken string) error {
+	_, err := db.Exec("INSERT OR REPLACE INTO webhook (channel_id, webhook_id, webhook_token) VALUES ($1, $2, $3)", channelID, webhookID, webhookToken)
+	return err
+}
+
+// DeleteWebhook forgets the webhook stored for a channel
+func DeleteWebhook(channelID string) error {
+	_, err := db.Exec("DELETE FROM webhook WHERE channel_id = $1", channelID)
+	return err
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maximumEmbedsPerMessage is the maximum number of embeds Discord allows in a single message
+const maximumEmbedsPerMessage = 10
+
+const (
+	stickerFormatTypePNG    = 1
+	stickerFormatTypeAPNG   = 2
+	stickerFormatTypeLottie = 3
+	stickerFormatTypeGIF    = 4
+)
+
+// stickerItem is the partial sticker object sent by Discord with a message.
+// discordgo does not support stickers yet, which is why this is needed.
+type stickerItem struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	FormatType int    `json:"format_type"`
+}
+
+// buildProxiedMessageEmbeds returns the embeds that must be sent with the copy of a message.
+//
+// Only rich embeds are carried over, because other types of embeds (e.g. link previews) are generated by Discord
+// from the links in the message's content, which means that Discord will generate them for the copy as well.
+func buildProxiedMessageEmbeds(message *discordgo.Message) []*discordgo.MessageEmbed {
+	var embeds []*discordgo.MessageEmbed
+	for _, embed := range message.Embeds {
+		if embed.Type != discordgo.EmbedTypeRich || len(embeds) == maximumEmbedsPerMessage {
+			continue
+		}
+		// Discord ignores the video and provider of embeds sent by bots, so there's no point in sending them
+		embedCopy := *embed
+		embedCopy.Video = nil
+		embedCopy.Provider = nil
+		embeds = append(embeds, &embedCopy)
+	}
+	return embeds
+}
+
+// buildStickerEmbedsAndContent converts the stickers of a message into image embeds. Since stickers in the Lottie
+// format cannot be displayed as an image, a text placeholder is returned for these instead.
+func buildStickerEmbedsAndContent(stickers []*stickerItem) (embeds []*discordgo.MessageEmbed, placeholder string) {
+	for _, sticker := range stickers {
+		switch sticker.FormatType {
+		case stickerFormatTypePNG, stickerFormatTypeAPNG:
+			embeds = append(embeds, &discordgo.MessageEmbed{Image: &discordgo.MessageEmbedImage{URL: "https://media.discordapp.net/stickers/" + sticker.ID + ".png"}})
+		case stickerFormatTypeGIF:
+			embeds = append(embeds, &discordgo.MessageEmbed{Image: &discordgo.MessageEmbedImage{URL: "https://media.discordapp.net/stickers/" + sticker.ID + ".gif"}})
+		default:
+			placeholder += "*[Sticker: " + sticker.Name + "]*"
+		}
+	}
+	return
+}
+
+// getStickers retrieves the stickers of a message.
+//
+// Because discordgo drops the stickers when decoding messages, the message has to be retrieved again from the API.
+// To avoid doing that for every single message, this should only be called for messages that appear to be empty.
+func getStickers(bot *discordgo.Session, message *discordgo.Message) []*stickerItem {
+	endpoint := discordgo.EndpointChannelMessage(message.ChannelID, message.ID)
+	response, err := bot.RequestWithBucketID("GET", endpoint, nil, discordgo.EndpointChannelMessage(message.ChannelID, ""))
+	if err != nil {
+		log.Printf("[getStickers] Failed to retrieve message=%s: %s", message.ID, err.Error())
+		return nil
+	}
+	var rawMessage struct {
+		StickerItems []*stickerItem `json:"sticker_items"`
+	}
+	if err = json.Unmarshal(response, &rawMessage); err != nil {
+		log.Printf("[getStickers] Failed to decode message=%s: %s", message.ID, err.Error())
+		return nil
+	}
+	return rawMessage.StickerItems
+}
+
+// firstEmbed returns the first embed of a list of embeds, or nil if there are none.
+// This is necessary because messages sent by the bot itself can only contain one embed with the current version of
+// discordgo, as opposed to messages sent through webhooks.
+func firstEmbed(embeds []*discordgo.MessageEmbed) *discordgo.MessageEmbed {
+	if len(embeds) == 0 {
+		return nil
+	}
+	return embeds[0]
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/TwiN/discord-channel-proxy-bot/database"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	filterRuleTypeWord  = "word"
+	filterRuleTypeGlob  = "glob"
+	filterRuleTypeRegex = "regex"
+
+	filterActionBlock  = "block"
+	filterActionRedact = "redact"
+	filterActionHold   = "hold"
+
+	// redactedText is what the text matched by a filter rule with the redact action is replaced with
+	redactedText = "[redacted]"
+
+	// maximumBlockedMessagesShown is the maximum number of blocked messages shown by the log subcommand of HandleFilter
+	maximumBlockedMessagesShown = 15
+)
+
+// wordRegex matches the words of a message that glob patterns are matched against
+var wordRegex = regexp.MustCompile(`\S+`)
+
+// HandleFilter shows or configures the filter rules of a binding of the channel in which the command was sent, which
+// may be any type of connection, including hubs and subscriptions.
+// Rules apply to messages proxied through the binding in both directions.
+// If the channel has several bindings, the channel of the binding must be passed as first argument.
+//
+// Usage: filter [CHANNEL_ID] [add word|glob|regex block|redact|hold PATTERN|remove RULE_ID|log]
+func HandleFilter(bot *discordgo.Session, message *discordgo.Message, query string) {
+	arguments := strings.Fields(query)
+	var otherChannelID string
+	if len(arguments) > 0 && channelIDRegex.MatchString(arguments[0]) {
+		otherChannelID = parseChannelID(arguments[0])
+		query = strings.TrimSpace(strings.TrimPrefix(query, arguments[0]))
+		arguments = arguments[1:]
+	}
+	if len(arguments) > 0 {
+		switch strings.ToLower(arguments[0]) {
+		case "remove", "delete":
+			handleRemoveFilterRule(bot, message.ChannelID, arguments[1:])
+			return
+		case "log":
+			handleFilterLog(bot, message.ChannelID)
+			return
+		}
+	}
+	if otherChannelID = resolveLinkedChannelID(bot, message.ChannelID, otherChannelID); len(otherChannelID) == 0 {
+		return
+	}
+	if len(arguments) == 0 {
+		rules, err := database.GetFilterRules(message.ChannelID, otherChannelID)
+		if err != nil {
+			_ = sendEmbed(bot, message.ChannelID, "Failed to retrieve filter rules", "```"+err.Error()+"```")
+			return
+		}
+		if len(rules) == 0 {
+			_ = sendEmbed(bot, message.ChannelID, "Messages proxied to and from "+describeChannel(bot, otherChannelID)+" are not filtered", fmt.Sprintf("Type `%sfilter add word|glob|regex block|redact|hold PATTERN` to add a rule", botCommandPrefix))
+			return
+		}
+		var lines []string
+		for _, rule := range rules {
+			lines = append(lines, describeFilterRule(rule))
+		}
+		_ = sendEmbed(bot, message.ChannelID, "Filter rules of the binding with "+describeChannel(bot, otherChannelID), joinEmbedLines(lines))
+		return
+	}
+	if strings.ToLower(arguments[0]) != "add" || len(arguments) < 4 {
+		_ = sendEmbed(bot, message.ChannelID, "Invalid arguments", fmt.Sprintf("Usage: `%sfilter [CHANNEL_ID] [add word|glob|regex block|redact|hold PATTERN|remove RULE_ID|log]`", botCommandPrefix))
+		return
+	}
+	// The pattern is everything after the action, so that it may contain spaces
+	pattern := query
+	for _, argument := range arguments[:3] {
+		pattern = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(pattern), argument))
+	}
+	rule := &database.FilterRule{
+		ChannelID:      message.ChannelID,
+		OtherChannelID: otherChannelID,
+		Type:           strings.ToLower(arguments[1]),
+		Pattern:        pattern,
+		Action:         strings.ToLower(arguments[2]),
+		CreatedAt:      time.Now(),
+	}
+	if rule.Action != filterActionBlock && rule.Action != filterActionRedact && rule.Action != filterActionHold {
+		_ = sendEmbed(bot, message.ChannelID, "Invalid action "+arguments[2], "Valid actions are `block`, `redact` and `hold`")
+		return
+	}
+	if _, err := compileFilterRule(rule); err != nil {
+		_ = sendEmbed(bot, message.ChannelID, "Invalid filter rule", "```"+err.Error()+"```")
+		return
+	}
+	if err := database.CreateFilterRule(rule); err != nil {
+		_ = sendEmbed(bot, message.ChannelID, "Failed to add filter rule", "```"+err.Error()+"```")
+		return
+	}
+	_ = sendEmbed(bot, message.ChannelID, "Filter rule added", describeFilterRule(rule))
+}
+
+func handleRemoveFilterRule(bot *discordgo.Session, channelID string, arguments []string) {
+	if len(arguments) == 0 {
+		_ = sendEmbed(bot, channelID, "Missing rule ID", fmt.Sprintf("Type `%sfilter` to see the IDs of the filter rules", botCommandPrefix))
+		return
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(arguments[0], "#"), 10, 64)
+	if err != nil {
+		_ = sendEmbed(bot, channelID, "Invalid rule ID "+arguments[0], "")
+		return
+	}
+	if err = database.DeleteFilterRule(channelID, id); err != nil {
+		if err == database.ErrNotFound {
+			_ = sendEmbed(bot, channelID, "There is no filter rule with ID "+arguments[0]+" created from this channel", "Rules created from the other channel can only be removed from that channel")
+		} else {
+			_ = sendEmbed(bot, channelID, "Failed to remove filter rule", "```"+err.Error()+"```")
+		}
+		return
+	}
+	_ = sendEmbed(bot, channelID, "Filter rule removed", "")
+}
+
+func handleFilterLog(bot *discordgo.Session, channelID string) {
+	blockedMessages, err := database.GetBlockedMessages(channelID, maximumBlockedMessagesShown)
+	if err != nil {
+		_ = sendEmbed(bot, channelID, "Failed to retrieve blocked messages", "```"+err.Error()+"```")
+		return
+	}
+	if len(blockedMessages) == 0 {
+		_ = sendEmbed(bot, channelID, "No messages have been blocked", "")
+		return
+	}
+	var lines []string
+	for _, blockedMessage := range blockedMessages {
+		lines = append(lines, fmt.Sprintf("- <t:%d:R> message %s from <@%s> in <#%s> to <#%s>: %s", blockedMessage.CreatedAt.Unix(), blockedMessage.SourceMessageID, blockedMessage.AuthorID, blockedMessage.SourceChannelID, blockedMessage.TargetChannelID, blockedMessage.Reason))
+	}
+	_ = sendEmbed(bot, channelID, "Recently blocked messages", joinEmbedLines(lines))
+}
+
+func describeFilterRule(rule *database.FilterRule) string {
+	return fmt.Sprintf("`#%d` %s %s: `%s` (set in <#%s>)", rule.ID, rule.Action, rule.Type, rule.Pattern, rule.ChannelID)
+}
+
+// filterMatcher matches the text of a message that a filter rule applies to
+type filterMatcher struct {
+	regex *regexp.Regexp
+
+	// wholeWords is whether regex must match each word of the message in its entirety, rather than any part of it
+	wholeWords bool
+
+	// wordBoundaries is whether the text matched by regex must not be preceded or followed by a word character if it
+	// starts or ends with one, which is what \b does, except that \b only knows about ASCII letters
+	wordBoundaries bool
+}
+
+// compileFilterRule returns the matcher of a filter rule, or an error if the type or the pattern of the rule is invalid.
+//
+// Words are matched regardless of case and only as whole words, globs are matched regardless of case against each word
+// of the message, where * matches any number of characters and ? matches a single character, and regular expressions
+// are matched as they are against the whole message.
+func compileFilterRule(rule *database.FilterRule) (*filterMatcher, error) {
+	if len(rule.Pattern) == 0 {
+		return nil, fmt.Errorf("the pattern must not be empty")
+	}
+	switch rule.Type {
+	case filterRuleTypeWord:
+		return &filterMatcher{regex: regexp.MustCompile(`(?i)` + regexp.QuoteMeta(rule.Pattern)), wordBoundaries: true}, nil
+	case filterRuleTypeGlob:
+		var expression string
+		for _, character := range rule.Pattern {
+			switch character {
+			case '*':
+				expression += ".*"
+			case '?':
+				expression += "."
+			default:
+				expression += regexp.QuoteMeta(string(character))
+			}
+		}
+		return &filterMatcher{regex: regexp.MustCompile(`(?i)^` + expression + `$`), wholeWords: true}, nil
+	case filterRuleTypeRegex:
+		regex, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		return &filterMatcher{regex: regex}, nil
+	default:
+		return nil, fmt.Errorf("invalid rule type %s, valid rule types are word, glob and regex", rule.Type)
+	}
+}
+
+func isWordCharacter(character rune) bool {
+	return character == '_' || unicode.IsLetter(character) || unicode.IsDigit(character)
+}
+
+// isWordBoundary returns whether the characters on each side of an index of a string aren't both word characters.
+// Unlike \b, this takes letters and digits of every script into account.
+func isWordBoundary(content string, index int) bool {
+	if index == 0 || index == len(content) {
+		return true
+	}
+	before, _ := utf8.DecodeLastRuneInString(content[:index])
+	after, _ := utf8.DecodeRuneInString(content[index:])
+	return !isWordCharacter(before) || !isWordCharacter(after)
+}
+
+// findAllIndex returns the location of each text of content matched by the regex of the matcher, skipping the text
+// that isn't at word boundaries if the matcher requires them
+func (matcher *filterMatcher) findAllIndex(content string) [][]int {
+	if !matcher.wordBoundaries {
+		return matcher.regex.FindAllStringIndex(content, -1)
+	}
+	var locations [][]int
+	for offset := 0; offset < len(content); {
+		location := matcher.regex.FindStringIndex(content[offset:])
+		if location == nil {
+			break
+		}
+		start, end := offset+location[0], offset+location[1]
+		if isWordBoundary(content, start) && isWordBoundary(content, end) {
+			locations = append(locations, []int{start, end})
+			offset = end
+		} else {
+			// The text may still match at the next character, e.g. "a-a" in "ba-a-a"
+			_, size := utf8.DecodeRuneInString(content[start:])
+			offset = start + size
+		}
+	}
+	return locations
+}
+
+func (matcher *filterMatcher) match(content string) bool {
+	if !matcher.wholeWords {
+		return len(matcher.findAllIndex(content)) > 0
+	}
+	for _, word := range wordRegex.FindAllString(content, -1) {
+		if matcher.regex.MatchString(word) {
+			return true
+		}
+	}
+	return false
+}
+
+func (matcher *filterMatcher) redact(content string) string {
+	if !matcher.wholeWords {
+		var redactedContent strings.Builder
+		var previousEnd int
+		for _, location := range matcher.findAllIndex(content) {
+			redactedContent.WriteString(content[previousEnd:location[0]])
+			redactedContent.WriteString(redactedText)
+			previousEnd = location[1]
+		}
+		redactedContent.WriteString(content[previousEnd:])
+		return redactedContent.String()
+	}
+	return wordRegex.ReplaceAllStringFunc(content, func(word string) string {
+		if matcher.regex.MatchString(word) {
+			return redactedText
+		}
+		return word
+	})
+}
+
+// filterMatcherCache keeps the matchers of the filter rules of each binding, so that the rules aren't compiled again
+// for every message
+type filterMatcherCache struct {
+	mutex    sync.Mutex
+	matchers map[string]map[int64]*filterMatcher
+}
+
+// matchers is the cache of the matchers of the filter rules of each binding
+var matchers = &filterMatcherCache{matchers: make(map[string]map[int64]*filterMatcher)}
+
+// get returns the matchers of the rules of a binding, compiling those of the rules that aren't in the cache yet.
+// Since the rules are retrieved for every message, the matchers of the rules that were removed are removed from the
+// cache as well.
+func (cache *filterMatcherCache) get(channelID, otherChannelID string, rules []*database.FilterRule) map[int64]*filterMatcher {
+	key := channelID + ":" + otherChannelID
+	if channelID > otherChannelID {
+		key = otherChannelID + ":" + channelID
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cachedMatchers := cache.matchers[key]
+	bindingMatchers := make(map[int64]*filterMatcher, len(rules))
+	for _, rule := range rules {
+		if matcher, ok := cachedMatchers[rule.ID]; ok {
+			bindingMatchers[rule.ID] = matcher
+			continue
+		}
+		matcher, err := compileFilterRule(rule)
+		if err != nil {
+			log.Printf("[filterMatcherCache.get] Skipping invalid filter rule=%d: %s", rule.ID, err.Error())
+		}
+		// Invalid rules are cached as well, so that they're only logged once
+		bindingMatchers[rule.ID] = matcher
+	}
+	if len(bindingMatchers) == 0 {
+		delete(cache.matchers, key)
+	} else {
+		cache.matchers[key] = bindingMatchers
+	}
+	return bindingMatchers
+}
+
+// filterContent checks the content of a message proxied from the source channel to the target channel against the
+// filter rules of their binding.
+// It returns the rule that decides what happens to the message if the message matched a rule with the block or hold
+// action, with rules with the block action taking precedence, as well as the content with the text matched by the
+// rules with the redact action redacted.
+func filterContent(sourceChannelID, targetChannelID, content string) (*database.FilterRule, string) {
+	rules, err := database.GetFilterRules(sourceChannelID, targetChannelID)
+	if err != nil {
+		log.Printf("[filterContent] Failed to get filter rules of binding between channel=%s and channel=%s: %s", sourceChannelID, targetChannelID, err.Error())
+		return nil, content
+	}
+	bindingMatchers := matchers.get(sourceChannelID, targetChannelID, rules)
+	var matchedRule *database.FilterRule
+	filteredContent := content
+	for _, rule := range rules {
+		matcher := bindingMatchers[rule.ID]
+		if matcher == nil || !matcher.match(content) {
+			continue
+		}
+		switch rule.Action {
+		case filterActionRedact:
+			filteredContent = matcher.redact(filteredContent)
+		case filterActionBlock:
+			if matchedRule == nil || matchedRule.Action != filterActionBlock {
+				matchedRule = rule
+			}
+		case filterActionHold:
+			if matchedRule == nil {
+				matchedRule = rule
+			}
+		}
+	}
+	return matchedRule, filteredContent
+}
+
+// handleFilteredMessage blocks or holds a message that matched a filter rule with the block or hold action, and
+// returns whether the message is waiting to be proxied.
+// Held messages are submitted for review if the target channel has a review channel for messages from the source
+// channel, and are added to the queue of the target channel otherwise.
+func handleFilteredMessage(bot *discordgo.Session, message *discordgo.Message, targetChannelID string, rule *database.FilterRule) (bool, error) {
+	if rule.Action == filterActionHold {
+		log.Printf("[handleFilteredMessage] Holding message=%s from=%s to=%s because it matched filter rule=%d", message.ID, message.ChannelID, targetChannelID, rule.ID)
+		if reviewChannelID := database.GetReviewChannelID(message.ChannelID, targetChannelID); len(reviewChannelID) > 0 {
+			return true, submitForReview(bot, message, targetChannelID, reviewChannelID)
+		}
+		return true, database.HoldMessage(&database.HeldMessage{SourceChannelID: message.ChannelID, SourceMessageID: message.ID, TargetChannelID: targetChannelID, CreatedAt: time.Now()})
+	}
+	log.Printf("[handleFilteredMessage] Blocking message=%s from=%s to=%s because it matched filter rule=%d", message.ID, message.ChannelID, targetChannelID, rule.ID)
+	return false, database.CreateBlockedMessage(&database.BlockedMessage{
+		SourceChannelID: message.ChannelID,
+		SourceMessageID: message.ID,
+		TargetChannelID: targetChannelID,
+		AuthorID:        message.Author.ID,
+		FilterRuleID:    rule.ID,
+		Reason:          fmt.Sprintf("matched %s rule `#%d` (`%s`)", rule.Type, rule.ID, rule.Pattern),
+		CreatedAt:       time.Now(),
+	})
+}
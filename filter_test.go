@@ -0,0 +1,292 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TwiN/discord-channel-proxy-bot/database"
+)
+
+func TestCompileFilterRule(t *testing.T) {
+	scenarios := []struct {
+		name           string
+		ruleType       string
+		pattern        string
+		content        string
+		expectedMatch  bool
+		expectedRedact string
+		expectedErr    bool
+	}{
+		{
+			name:           "word",
+			ruleType:       filterRuleTypeWord,
+			pattern:        "bad",
+			content:        "this is BAD.",
+			expectedMatch:  true,
+			expectedRedact: "this is [redacted].",
+		},
+		{
+			name:           "word-within-another-word",
+			ruleType:       filterRuleTypeWord,
+			pattern:        "bad",
+			content:        "notbad badly",
+			expectedMatch:  false,
+			expectedRedact: "notbad badly",
+		},
+		{
+			name:           "word-several-times",
+			ruleType:       filterRuleTypeWord,
+			pattern:        "bad",
+			content:        "bad bad",
+			expectedMatch:  true,
+			expectedRedact: "[redacted] [redacted]",
+		},
+		{
+			name:           "word-with-accent",
+			ruleType:       filterRuleTypeWord,
+			pattern:        "café",
+			content:        "un CAFÉ noir",
+			expectedMatch:  true,
+			expectedRedact: "un [redacted] noir",
+		},
+		{
+			name:           "word-with-accent-within-another-word",
+			ruleType:       filterRuleTypeWord,
+			pattern:        "caf",
+			content:        "un café",
+			expectedMatch:  false,
+			expectedRedact: "un café",
+		},
+		{
+			name:           "word-in-another-script",
+			ruleType:       filterRuleTypeWord,
+			pattern:        "дурак",
+			content:        "ты дурак!",
+			expectedMatch:  true,
+			expectedRedact: "ты [redacted]!",
+		},
+		{
+			name:           "word-starting-with-a-symbol",
+			ruleType:       filterRuleTypeWord,
+			pattern:        "@everyone",
+			content:        "hi @everyone",
+			expectedMatch:  true,
+			expectedRedact: "hi [redacted]",
+		},
+		{
+			name:           "word-overlapping-a-rejected-match",
+			ruleType:       filterRuleTypeWord,
+			pattern:        "a-a",
+			content:        "ba-a-a",
+			expectedMatch:  true,
+			expectedRedact: "ba-[redacted]",
+		},
+		{
+			name:           "glob",
+			ruleType:       filterRuleTypeGlob,
+			pattern:        "f*k",
+			content:        "what the FUNK",
+			expectedMatch:  true,
+			expectedRedact: "what the [redacted]",
+		},
+		{
+			name:           "glob-single-character",
+			ruleType:       filterRuleTypeGlob,
+			pattern:        "c?t",
+			content:        "cart cut",
+			expectedMatch:  true,
+			expectedRedact: "cart [redacted]",
+		},
+		{
+			name:           "glob-only-matches-whole-words",
+			ruleType:       filterRuleTypeGlob,
+			pattern:        "c?t",
+			content:        "cats",
+			expectedMatch:  false,
+			expectedRedact: "cats",
+		},
+		{
+			name:           "regex",
+			ruleType:       filterRuleTypeRegex,
+			pattern:        `\d{4}`,
+			content:        "my pin is 1234",
+			expectedMatch:  true,
+			expectedRedact: "my pin is [redacted]",
+		},
+		{
+			name:           "regex-is-case-sensitive",
+			ruleType:       filterRuleTypeRegex,
+			pattern:        `secret`,
+			content:        "SECRET",
+			expectedMatch:  false,
+			expectedRedact: "SECRET",
+		},
+		{
+			name:        "invalid-regex",
+			ruleType:    filterRuleTypeRegex,
+			pattern:     "(",
+			expectedErr: true,
+		},
+		{
+			name:        "invalid-type",
+			ruleType:    "phrase",
+			pattern:     "bad",
+			expectedErr: true,
+		},
+		{
+			name:        "empty-pattern",
+			ruleType:    filterRuleTypeWord,
+			pattern:     "",
+			expectedErr: true,
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			matcher, err := compileFilterRule(&database.FilterRule{Type: scenario.ruleType, Pattern: scenario.pattern})
+			if scenario.expectedErr {
+				if err == nil {
+					t.Error("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("expected no error, got", err.Error())
+			}
+			if match := matcher.match(scenario.content); match != scenario.expectedMatch {
+				t.Errorf("expected match to be %v, got %v", scenario.expectedMatch, match)
+			}
+			if redacted := matcher.redact(scenario.content); redacted != scenario.expectedRedact {
+				t.Errorf("expected %q, got %q", scenario.expectedRedact, redacted)
+			}
+		})
+	}
+}
+
+func TestFilterContent(t *testing.T) {
+	if err := database.Initialize(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal("failed to initialize database:", err.Error())
+	}
+	type rule struct {
+		// fromOtherChannel is whether the rule was created from the target channel rather than from the source channel
+		fromOtherChannel bool
+		ruleType         string
+		pattern          string
+		action           string
+	}
+	scenarios := []struct {
+		name            string
+		rules           []rule
+		content         string
+		expectedAction  string
+		expectedContent string
+	}{
+		{
+			name:            "no-rules",
+			content:         "hello",
+			expectedContent: "hello",
+		},
+		{
+			name:            "no-match",
+			rules:           []rule{{ruleType: filterRuleTypeWord, pattern: "bad", action: filterActionBlock}},
+			content:         "hello",
+			expectedContent: "hello",
+		},
+		{
+			name:            "redact",
+			rules:           []rule{{ruleType: filterRuleTypeWord, pattern: "bad", action: filterActionRedact}},
+			content:         "a bad word",
+			expectedContent: "a [redacted] word",
+		},
+		{
+			name: "several-redactions",
+			rules: []rule{
+				{ruleType: filterRuleTypeWord, pattern: "bad", action: filterActionRedact},
+				{ruleType: filterRuleTypeRegex, pattern: `\d+`, action: filterActionRedact},
+			},
+			content:         "bad 123",
+			expectedContent: "[redacted] [redacted]",
+		},
+		{
+			name:            "hold",
+			rules:           []rule{{ruleType: filterRuleTypeWord, pattern: "link", action: filterActionHold}},
+			content:         "a link",
+			expectedAction:  filterActionHold,
+			expectedContent: "a link",
+		},
+		{
+			name: "block-takes-precedence-over-hold",
+			rules: []rule{
+				{ruleType: filterRuleTypeWord, pattern: "link", action: filterActionHold},
+				{ruleType: filterRuleTypeWord, pattern: "spam", action: filterActionBlock},
+			},
+			content:         "a link to spam",
+			expectedAction:  filterActionBlock,
+			expectedContent: "a link to spam",
+		},
+		{
+			name:            "rule-created-from-the-other-channel",
+			rules:           []rule{{fromOtherChannel: true, ruleType: filterRuleTypeGlob, pattern: "spam*", action: filterActionBlock}},
+			content:         "spammy",
+			expectedAction:  filterActionBlock,
+			expectedContent: "spammy",
+		},
+		{
+			name: "invalid-rule-is-skipped",
+			rules: []rule{
+				{ruleType: filterRuleTypeRegex, pattern: "(", action: filterActionBlock},
+				{ruleType: filterRuleTypeWord, pattern: "bad", action: filterActionRedact},
+			},
+			content:         "bad (",
+			expectedContent: "[redacted] (",
+		},
+	}
+	for i, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			// Each scenario has its own binding, so that the rules of the other scenarios don't apply
+			sourceChannelID, targetChannelID := "source-"+scenario.name, "target-"+scenario.name
+			for _, r := range scenario.rules {
+				filterRule := &database.FilterRule{ChannelID: sourceChannelID, OtherChannelID: targetChannelID, Type: r.ruleType, Pattern: r.pattern, Action: r.action, CreatedAt: time.Now()}
+				if r.fromOtherChannel {
+					filterRule.ChannelID, filterRule.OtherChannelID = targetChannelID, sourceChannelID
+				}
+				if err := database.CreateFilterRule(filterRule); err != nil {
+					t.Fatalf("scenario #%d: failed to create filter rule: %s", i, err.Error())
+				}
+			}
+			// The content is filtered twice, so that the matchers cached the first time are used the second time
+			for attempt := 0; attempt < 2; attempt++ {
+				matchedRule, content := filterContent(sourceChannelID, targetChannelID, scenario.content)
+				var action string
+				if matchedRule != nil {
+					action = matchedRule.Action
+				}
+				if action != scenario.expectedAction {
+					t.Errorf("expected the action to be %q, got %q", scenario.expectedAction, action)
+				}
+				if content != scenario.expectedContent {
+					t.Errorf("expected %q, got %q", scenario.expectedContent, content)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterContent_ruleRemoved(t *testing.T) {
+	if err := database.Initialize(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal("failed to initialize database:", err.Error())
+	}
+	rule := &database.FilterRule{ChannelID: "removed-1", OtherChannelID: "removed-2", Type: filterRuleTypeWord, Pattern: "bad", Action: filterActionBlock, CreatedAt: time.Now()}
+	if err := database.CreateFilterRule(rule); err != nil {
+		t.Fatal("failed to create filter rule:", err.Error())
+	}
+	if matchedRule, _ := filterContent("removed-1", "removed-2", "bad"); matchedRule == nil {
+		t.Fatal("expected the message to match the rule")
+	}
+	if err := database.DeleteFilterRule("removed-1", rule.ID); err != nil {
+		t.Fatal("failed to delete filter rule:", err.Error())
+	}
+	if matchedRule, _ := filterContent("removed-1", "removed-2", "bad"); matchedRule != nil {
+		t.Error("expected the message to no longer match the rule once it was removed")
+	}
+}
@@ -3,7 +3,6 @@ module github.com/TwiN/discord-channel-proxy-bot
 go 1.16
 
 require (
-	github.com/TwiN/gocache/v2 v2.0.0
 	github.com/bwmarrin/discordgo v0.23.2
 	modernc.org/sqlite v1.12.0
 )
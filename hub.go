@@ -0,0 +1,225 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/TwiN/discord-channel-proxy-bot/database"
+	"github.com/bwmarrin/discordgo"
+)
+
+var hubNameRegex = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// HandleHub handles the hub command, which allows any number of channels to be bound together
+func HandleHub(bot *discordgo.Session, message *discordgo.Message, query string) {
+	arguments := strings.Fields(strings.ToLower(query))
+	if len(arguments) == 0 {
+		HandleHubInfo(bot, message.ChannelID)
+		return
+	}
+	switch arguments[0] {
+	case "create", "join":
+		if len(arguments) != 2 || !hubNameRegex.MatchString(arguments[1]) {
+			_ = sendEmbed(bot, message.ChannelID, "Invalid hub name", "Hub names must be between 1 and 32 characters long and can only contain lowercase letters, numbers, `-` and `_`")
+			return
+		}
+		if arguments[0] == "create" {
+			HandleHubJoin(bot, message.ChannelID, arguments[1], true)
+		} else {
+			HandleHubJoinRequest(bot, message.ChannelID, arguments[1])
+		}
+	case "accept":
+		if len(arguments) != 2 {
+			_ = sendEmbed(bot, message.ChannelID, "Missing channel", "Usage: `"+botCommandPrefix+"hub accept CHANNEL_ID`")
+			return
+		}
+		HandleHubAccept(bot, message.ChannelID, parseChannelID(arguments[1]))
+	case "invite":
+		var otherChannel string
+		if len(arguments) > 1 {
+			otherChannel = arguments[1]
+		}
+		HandleHubInvite(bot, message.ChannelID, otherChannel)
+	case "leave":
+		HandleHubLeave(bot, message.ChannelID)
+	default:
+		_ = sendEmbed(bot, message.ChannelID, "Unknown hub command", "Usage: `"+botCommandPrefix+"hub [create <name>|join <name>|invite [channel]|accept <channel>|leave]`")
+	}
+}
+
+// HandleHubJoinRequest sends a request to join a hub to every member of the hub, since a channel can only join a hub
+// once one of its members has accepted it
+func HandleHubJoinRequest(bot *discordgo.Session, channelID, hubName string) {
+	if currentHubName, err := database.GetHubNameByChannelID(channelID); err == nil {
+		_ = sendEmbed(bot, channelID, "Channel is already a member of hub "+currentHubName, "")
+		return
+	}
+	hubChannelIDs, err := database.GetHubChannelIDs(hubName)
+	if err != nil {
+		_ = sendEmbed(bot, channelID, "Failed to retrieve hub members", "```"+err.Error()+"```")
+		return
+	}
+	if len(hubChannelIDs) == 0 {
+		_ = sendEmbed(bot, channelID, "There is no hub named "+hubName, "")
+		return
+	}
+	for _, hubChannelID := range hubChannelIDs {
+		if err = sendBindRequest(bot, newBindRequest(database.RequestTypeHubJoin, channelID, hubChannelID)); err != nil {
+			log.Printf("[HandleHubJoinRequest] Failed to send request from=%s to=%s: %s", channelID, hubChannelID, err.Error())
+		}
+	}
+	_ = sendEmbed(bot, channelID, "Request to join hub "+hubName+" sent", "The channel will join the hub once a member of the hub accepts the request")
+}
+
+// HandleHubInvite invites a channel bound to the channel in which the command was sent to join the hub of the latter.
+// If the other channel accepts, their binding is replaced by the hub, since both channels are then members of it.
+// Channels bound to a member of a hub never join it on their own, since they didn't agree to receive the messages of
+// the other members.
+func HandleHubInvite(bot *discordgo.Session, channelID, otherChannel string) {
+	hubName, err := database.GetHubNameByChannelID(channelID)
+	if err != nil {
+		_ = sendEmbed(bot, channelID, "Channel is not a member of any hub", "")
+		return
+	}
+	otherChannelID := resolveConnectedChannelID(bot, channelID, otherChannel)
+	if len(otherChannelID) == 0 {
+		return
+	}
+	if otherHubName, err := database.GetHubNameByChannelID(otherChannelID); err == nil {
+		_ = sendEmbed(bot, channelID, "Channel "+otherChannelID+" is already a member of hub "+otherHubName, "")
+		return
+	}
+	if err = sendBindRequest(bot, newBindRequest(database.RequestTypeHubInvite, channelID, otherChannelID)); err != nil {
+		_ = sendEmbed(bot, channelID, "Failed to send invitation", "```"+err.Error()+"```")
+		return
+	}
+	_ = sendEmbed(bot, channelID, "Invitation to join hub "+hubName+" sent", "The binding with "+otherChannelID+" will be replaced by the hub once the channel accepts the invitation")
+}
+
+// HandleHubAccept accepts the request of a channel to join the hub the channel in which the command was sent is a
+// member of, or the invitation of a channel to join its hub
+func HandleHubAccept(bot *discordgo.Session, channelID, requestingChannelID string) {
+	if err := database.ConsumeBindRequest(database.RequestTypeHubInvite, requestingChannelID, channelID); err == nil {
+		handleHubInviteAccept(bot, channelID, requestingChannelID)
+		return
+	}
+	hubName, err := database.GetHubNameByChannelID(channelID)
+	if err != nil {
+		_ = sendEmbed(bot, channelID, "Channel is not a member of any hub", "")
+		return
+	}
+	if err = database.ConsumeBindRequest(database.RequestTypeHubJoin, requestingChannelID, channelID); err != nil {
+		_ = sendEmbed(bot, channelID, "There is no pending request from "+requestingChannelID+" to join the hub", "")
+		return
+	}
+	// The request was sent to every member of the hub, so the others no longer need to answer it
+	if err = database.DeleteBindRequestsFromChannel(database.RequestTypeHubJoin, requestingChannelID); err != nil {
+		log.Printf("[HandleHubAccept] Failed to delete the other requests from=%s: %s", requestingChannelID, err.Error())
+	}
+	HandleHubJoin(bot, requestingChannelID, hubName, false)
+}
+
+// handleHubInviteAccept adds a channel to the hub of the channel that invited it, and replaces the binding between the
+// two channels by the hub
+func handleHubInviteAccept(bot *discordgo.Session, channelID, invitingChannelID string) {
+	hubName, err := database.GetHubNameByChannelID(invitingChannelID)
+	if err != nil {
+		_ = sendEmbed(bot, channelID, "Channel "+invitingChannelID+" is no longer a member of any hub", "")
+		return
+	}
+	if currentHubName, err := database.GetHubNameByChannelID(channelID); err == nil {
+		_ = sendEmbed(bot, channelID, "Channel is already a member of hub "+currentHubName, "")
+		return
+	}
+	if !HandleHubJoin(bot, channelID, hubName, false) {
+		return
+	}
+	migrateConnectionToHub(bot, channelID, invitingChannelID, hubName)
+}
+
+// migrateConnectionToHub deletes the connection between two channels that are now members of the same hub, so that
+// they keep receiving each other's messages through the hub rather than twice
+func migrateConnectionToHub(bot *discordgo.Session, channelID, otherChannelID, hubName string) {
+	if err := database.DeleteConnection(channelID, otherChannelID); err != nil {
+		if err != database.ErrNotFound {
+			log.Printf("[migrateConnectionToHub] Failed to delete connection between %s and %s: %s", channelID, otherChannelID, err.Error())
+			_ = sendEmbed(bot, channelID, "Failed to replace the binding with "+otherChannelID+" by the hub", "```"+err.Error()+"```")
+		}
+		return
+	}
+	log.Printf("[migrateConnectionToHub] Migrated connection between %s and %s to hub=%s", channelID, otherChannelID, hubName)
+	_ = sendEmbed(bot, channelID, "Binding with "+otherChannelID+" replaced by hub "+hubName, "")
+	_ = sendEmbed(bot, otherChannelID, "Binding with "+channelID+" replaced by hub "+hubName, "")
+}
+
+// HandleHubJoin adds a channel to a hub, creating the hub first if create is true, and returns whether the channel
+// joined the hub
+func HandleHubJoin(bot *discordgo.Session, channelID, hubName string, create bool) bool {
+	var err error
+	if create {
+		err = database.CreateHub(hubName, channelID)
+	} else {
+		err = database.JoinHub(hubName, channelID)
+	}
+	if err != nil {
+		if err == database.ErrNotFound {
+			_ = sendEmbed(bot, channelID, "There is no hub named "+hubName, "")
+		} else {
+			_ = sendEmbed(bot, channelID, "Failed to join hub", "```"+err.Error()+"```")
+		}
+		return false
+	}
+	// The bindings the channel already has are left as they are, since the channels it's bound to didn't agree to join
+	// the hub, unless they're invited to and accept
+	log.Printf("[HandleHubJoin] Channel=%s joined hub=%s", channelID, hubName)
+	hubChannelIDs, _ := database.GetHubChannelIDs(hubName)
+	for _, hubChannelID := range hubChannelIDs {
+		if hubChannelID != channelID {
+			_ = sendEmbed(bot, hubChannelID, "Channel "+channelID+" joined the hub", "")
+		}
+	}
+	_ = sendEmbed(bot, channelID, "Channel joined hub "+hubName, "")
+	return true
+}
+
+// HandleHubLeave removes a channel from the hub it's a member of
+func HandleHubLeave(bot *discordgo.Session, channelID string) {
+	hubName, _ := database.GetHubNameByChannelID(channelID)
+	if err := database.LeaveHub(channelID); err != nil {
+		_ = sendEmbed(bot, channelID, "Failed to leave hub", "```"+err.Error()+"```")
+		return
+	}
+	hubChannelIDs, _ := database.GetHubChannelIDs(hubName)
+	for _, hubChannelID := range hubChannelIDs {
+		_ = sendEmbed(bot, hubChannelID, "Channel "+channelID+" left the hub", "")
+	}
+	_ = sendEmbed(bot, channelID, "Channel left hub "+hubName, "")
+}
+
+// HandleHubInfo shows the hub a channel is a member of, as well as the other members of that hub
+func HandleHubInfo(bot *discordgo.Session, channelID string) {
+	hubName, err := database.GetHubNameByChannelID(channelID)
+	if err != nil {
+		_ = sendEmbed(bot, channelID, "Channel is not a member of any hub", "Usage: `"+botCommandPrefix+"hub [create <name>|join <name>|invite [channel]|accept <channel>|leave]`")
+		return
+	}
+	hubChannelIDs, err := database.GetHubChannelIDs(hubName)
+	if err != nil {
+		_ = sendEmbed(bot, channelID, "Failed to retrieve hub members", "```"+err.Error()+"```")
+		return
+	}
+	_ = sendEmbed(bot, channelID, "Hub "+hubName, describeChannels(bot, hubChannelIDs))
+}
+
+// describeChannel returns a human-readable description of a channel, which includes the name of its guild if possible
+func describeChannel(bot *discordgo.Session, channelID string) string {
+	channel, err := getChannel(bot, channelID)
+	if err != nil {
+		return channelID
+	}
+	if guild, err := bot.State.Guild(channel.GuildID); err == nil {
+		return "#" + channel.Name + " (" + guild.Name + ", " + channelID + ")"
+	}
+	return "#" + channel.Name + " (" + channelID + ")"
+}
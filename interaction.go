@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+
+	"github.com/TwiN/discord-channel-proxy-bot/database"
+	"github.com/bwmarrin/discordgo"
+)
+
+// The version of discordgo used does not support interactions yet, which is why slash commands and buttons are
+// implemented here using the raw gateway events and Discord's API directly.
+
+const (
+	interactionTypeApplicationCommand = 2
+	interactionTypeMessageComponent   = 3
+	interactionTypeAutocomplete       = 4
+	interactionTypeModalSubmit        = 5
+
+	interactionResponseTypeChannelMessage         = 4
+	interactionResponseTypeDeferredChannelMessage = 5
+	interactionResponseTypeDeferredUpdateMessage  = 6
+	interactionResponseTypeUpdateMessage          = 7
+	interactionResponseTypeAutocompleteResult     = 8
+	interactionResponseTypeModal                  = 9
+
+	applicationCommandOptionTypeString = 3
+
+	componentTypeActionRow = 1
+	componentTypeButton    = 2
+	componentTypeTextInput = 4
+	buttonStyleSuccess     = 3
+	buttonStyleDanger      = 4
+
+	textInputStyleParagraph = 2
+
+	ephemeralMessageFlag = 1 << 6
+
+	// maximumAutocompleteChoices is the maximum number of choices Discord allows in an autocomplete result
+	maximumAutocompleteChoices = 25
+
+	acceptRequestButtonPrefix  = "accept:"
+	declineRequestButtonPrefix = "decline:"
+)
+
+type interaction struct {
+	ID        string             `json:"id"`
+	Type      int                `json:"type"`
+	Token     string             `json:"token"`
+	GuildID   string             `json:"guild_id"`
+	ChannelID string             `json:"channel_id"`
+	Member    *discordgo.Member  `json:"member"`
+	User      *discordgo.User    `json:"user"`
+	Message   *discordgo.Message `json:"message"`
+	Data      struct {
+		Name     string               `json:"name"`
+		Options  []*interactionOption `json:"options"`
+		CustomID string               `json:"custom_id"`
+
+		// Components are the rows of the form that was submitted, if the interaction is the submission of a form
+		Components []struct {
+			Components []struct {
+				CustomID string `json:"custom_id"`
+				Value    string `json:"value"`
+			} `json:"components"`
+		} `json:"components"`
+	} `json:"data"`
+}
+
+type interactionOption struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	Focused bool   `json:"focused"`
+}
+
+type interactionResponse struct {
+	Type int                      `json:"type"`
+	Data *interactionResponseData `json:"data,omitempty"`
+}
+
+type interactionResponseData struct {
+	CustomID   string                      `json:"custom_id,omitempty"`
+	Title      string                      `json:"title,omitempty"`
+	Content    string                      `json:"content,omitempty"`
+	Flags      int                         `json:"flags,omitempty"`
+	Components []interface{}               `json:"components"`
+	Choices    []*applicationCommandChoice `json:"choices,omitempty"`
+}
+
+type applicationCommand struct {
+	Name        string                      `json:"name"`
+	Description string                      `json:"description"`
+	Options     []*applicationCommandOption `json:"options,omitempty"`
+}
+
+type applicationCommandOption struct {
+	Type         int    `json:"type"`
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	Required     bool   `json:"required"`
+	Autocomplete bool   `json:"autocomplete"`
+}
+
+type applicationCommandChoice struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type actionRow struct {
+	Type       int           `json:"type"`
+	Components []interface{} `json:"components"`
+}
+
+type button struct {
+	Type     int    `json:"type"`
+	Style    int    `json:"style"`
+	Label    string `json:"label"`
+	CustomID string `json:"custom_id"`
+}
+
+type textInput struct {
+	Type      int    `json:"type"`
+	Style     int    `json:"style"`
+	Label     string `json:"label"`
+	CustomID  string `json:"custom_id"`
+	MaxLength int    `json:"max_length,omitempty"`
+}
+
+// applicationCommands are the slash commands registered by the bot. Every slash command has a text command with the
+// same name, which is what's executed when the slash command is used.
+var applicationCommands = []*applicationCommand{
+	{Name: "bind", Description: "Send a binding request to a channel, or accept one", Options: []*applicationCommandOption{channelOption("Channel to bind to", true)}},
+	{Name: "unbind", Description: "Delete the binding with a channel", Options: []*applicationCommandOption{channelOption("Bound channel, if there are several", false)}},
+	{Name: "lock", Description: "Stop proxying messages to this channel", Options: []*applicationCommandOption{channelOption("Only lock the binding with this channel", false)}},
+	{Name: "unlock", Description: "Resume proxying messages to this channel", Options: []*applicationCommandOption{channelOption("Only unlock the binding with this channel", false)}},
+	{Name: "pull", Description: "Proxy the messages that were held while this channel was locked"},
+	{Name: "clear", Description: "Delete the messages in this channel, or in a bound channel", Options: []*applicationCommandOption{channelOption("Bound channel to clear instead of this one", false)}},
+	{Name: "status", Description: "Show the bindings of this channel"},
+}
+
+func channelOption(description string, required bool) *applicationCommandOption {
+	return &applicationCommandOption{Type: applicationCommandOptionTypeString, Name: "channel", Description: description, Required: required, Autocomplete: true}
+}
+
+// registerApplicationCommands registers the slash commands of the bot, replacing the ones that were registered before
+func registerApplicationCommands(bot *discordgo.Session) error {
+	endpoint := discordgo.EndpointAPI + "applications/" + bot.State.User.ID + "/commands"
+	_, err := bot.RequestWithBucketID("PUT", endpoint, applicationCommands, endpoint)
+	return err
+}
+
+// HandleInteraction handles the slash commands as well as the clicks on the buttons sent by the bot
+func HandleInteraction(bot *discordgo.Session, event *discordgo.Event) {
+	if event.Type != "INTERACTION_CREATE" {
+		return
+	}
+	var i *interaction
+	if err := json.Unmarshal(event.RawData, &i); err != nil {
+		log.Println("[HandleInteraction] Failed to decode interaction:", err.Error())
+		return
+	}
+	if i.Member != nil && i.Member.User != nil {
+		i.User = i.Member.User
+	}
+	if i.User == nil {
+		return
+	}
+	switch i.Type {
+	case interactionTypeApplicationCommand:
+		handleApplicationCommand(bot, i)
+	case interactionTypeMessageComponent:
+		if i.Data.CustomID == approveReviewButtonID || i.Data.CustomID == rejectReviewButtonID {
+			handleReviewInteraction(bot, i)
+		} else {
+			handleButton(bot, i)
+		}
+	case interactionTypeAutocomplete:
+		handleAutocomplete(bot, i)
+	case interactionTypeModalSubmit:
+		if strings.HasPrefix(i.Data.CustomID, rejectReviewButtonID+":") {
+			handleReviewInteraction(bot, i)
+		}
+	}
+}
+
+// handleApplicationCommand runs the text command matching the slash command used.
+// Since the text commands report their result in the channel, the interaction is only acknowledged privately, and the
+// acknowledgement is deleted once the command is done.
+func handleApplicationCommand(bot *discordgo.Session, i *interaction) {
+	if err := respondToInteraction(bot, i, &interactionResponse{Type: interactionResponseTypeDeferredChannelMessage, Data: &interactionResponseData{Flags: ephemeralMessageFlag}}); err != nil {
+		log.Printf("[handleApplicationCommand] Failed to acknowledge command=%s: %s", i.Data.Name, err.Error())
+		return
+	}
+	command, query := i.Data.Name, getInteractionOption(i, "channel")
+	if command == "clear" && len(query) > 0 {
+		command = "clearother"
+	}
+	log.Printf("[handleApplicationCommand] channel=%s; command=%s; arguments=%s", i.ChannelID, command, query)
+	runCommand(bot, interactionToMessage(i), command, query)
+	endpoint := discordgo.EndpointWebhookToken(bot.State.User.ID, i.Token) + "/messages/@original"
+	if _, err := bot.RequestWithBucketID("DELETE", endpoint, nil, discordgo.EndpointWebhookToken("", "")); err != nil {
+		log.Printf("[handleApplicationCommand] Failed to delete acknowledgement of command=%s: %s", i.Data.Name, err.Error())
+	}
+}
+
+// handleButton handles the Accept and Decline buttons of requests.
+// Accepting a request is the same as replying to it with the matching command, while declining it cancels it.
+func handleButton(bot *discordgo.Session, i *interaction) {
+	var command, query string
+	if strings.HasPrefix(i.Data.CustomID, acceptRequestButtonPrefix) {
+		arguments := strings.SplitN(strings.TrimPrefix(i.Data.CustomID, acceptRequestButtonPrefix), ":", 2)
+		if len(arguments) != 2 {
+			return
+		}
+		_, command = describeBindRequest(&database.BindRequest{Type: arguments[0]})
+		query = arguments[1]
+		if parts := strings.SplitN(command, " ", 2); len(parts) == 2 {
+			// The reply command has a subcommand (e.g. hub accept), which is passed as the first argument
+			command, query = parts[0], parts[1]+" "+query
+		}
+	} else if strings.HasPrefix(i.Data.CustomID, declineRequestButtonPrefix) {
+		command, query = "cancel", strings.TrimPrefix(i.Data.CustomID, declineRequestButtonPrefix)
+	} else {
+		return
+	}
+	message := interactionToMessage(i)
+	if allowed, requirement := canUseCommand(bot, message.GuildID, message.ChannelID, message.Author.ID, message.Member.Roles, command); !allowed {
+		_ = respondToInteraction(bot, i, &interactionResponse{Type: interactionResponseTypeChannelMessage, Data: &interactionResponseData{Content: "You are not allowed to answer this request. " + requirement, Flags: ephemeralMessageFlag}})
+		return
+	}
+	// Remove the buttons, since the request can only be answered once
+	if err := respondToInteraction(bot, i, &interactionResponse{Type: interactionResponseTypeUpdateMessage, Data: &interactionResponseData{Components: []interface{}{}}}); err != nil {
+		log.Printf("[handleButton] Failed to remove buttons of request from=%s: %s", query, err.Error())
+	}
+	runCommand(bot, message, command, query)
+}
+
+// handleAutocomplete suggests the channels that are relevant to the command being typed: the channels that sent a
+// request to this channel for bind, and the channels bound to this channel for every other command
+func handleAutocomplete(bot *discordgo.Session, i *interaction) {
+	var channelIDs []string
+	if i.Data.Name == "bind" {
+		requests, _ := database.GetBindRequestsByChannelID(i.ChannelID)
+		for _, request := range requests {
+			if request.Type == database.RequestTypeBind && request.ToChannelID == i.ChannelID {
+				channelIDs = append(channelIDs, request.FromChannelID)
+			}
+		}
+	} else {
+		channelIDs, _ = database.GetConnectedChannelIDs(i.ChannelID)
+	}
+	typed := strings.ToLower(getInteractionOption(i, "channel"))
+	choices := make([]*applicationCommandChoice, 0, len(channelIDs))
+	for _, channelID := range channelIDs {
+		name := describeChannel(bot, channelID)
+		if runes := []rune(name); len(runes) > 100 {
+			name = string(runes[:100])
+		}
+		if strings.Contains(strings.ToLower(name), typed) && len(choices) < maximumAutocompleteChoices {
+			choices = append(choices, &applicationCommandChoice{Name: name, Value: channelID})
+		}
+	}
+	if err := respondToInteraction(bot, i, &interactionResponse{Type: interactionResponseTypeAutocompleteResult, Data: &interactionResponseData{Choices: choices}}); err != nil {
+		log.Printf("[handleAutocomplete] Failed to suggest channels for command=%s: %s", i.Data.Name, err.Error())
+	}
+}
+
+func respondToInteraction(bot *discordgo.Session, i *interaction, response *interactionResponse) error {
+	endpoint := discordgo.EndpointAPI + "interactions/" + i.ID + "/" + i.Token + "/callback"
+	_, err := bot.RequestWithBucketID("POST", endpoint, response, discordgo.EndpointAPI+"interactions/")
+	return err
+}
+
+func getInteractionOption(i *interaction, name string) string {
+	for _, option := range i.Data.Options {
+		if option.Name == name {
+			return strings.TrimSpace(option.Value)
+		}
+	}
+	return ""
+}
+
+// getModalValue returns the value of a field of the form that was submitted
+func getModalValue(i *interaction, customID string) string {
+	for _, row := range i.Data.Components {
+		for _, component := range row.Components {
+			if component.CustomID == customID {
+				return strings.TrimSpace(component.Value)
+			}
+		}
+	}
+	return ""
+}
+
+// interactionToMessage converts an interaction into a message, so that interactions can be handled like text commands
+func interactionToMessage(i *interaction) *discordgo.Message {
+	member := i.Member
+	if member == nil {
+		member = &discordgo.Member{User: i.User}
+	}
+	return &discordgo.Message{ChannelID: i.ChannelID, GuildID: i.GuildID, Author: i.User, Member: member}
+}
+
+// sendEmbedWithButtons sends an embed along with buttons
+func sendEmbedWithButtons(bot *discordgo.Session, channelID, title, description string, buttons ...*button) error {
+	_, err := sendMessageWithButtons(bot, channelID, &discordgo.MessageEmbed{Type: discordgo.EmbedTypeRich, Title: title, Description: description}, buttons...)
+	return err
+}
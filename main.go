@@ -1,31 +1,44 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/TwiN/discord-channel-proxy-bot/database"
-	"github.com/TwiN/gocache/v2"
 	"github.com/bwmarrin/discordgo"
 )
 
+// maximumBulkDeleteMessages is the maximum number of messages Discord allows deleting at once
+const maximumBulkDeleteMessages = 100
+
 var (
-	token               = os.Getenv("DISCORD_BOT_TOKEN")
-	botCommandPrefix    = os.Getenv("COMMAND_PREFIX")
-	pendingBindRequests = gocache.NewCache().WithMaxSize(1000)
+	token            = os.Getenv("DISCORD_BOT_TOKEN")
+	botCommandPrefix = os.Getenv("COMMAND_PREFIX")
 
 	killChannel chan os.Signal
+
+	// errNothingToProxy is returned by proxyMessage when a message has nothing that can be sent to the target channel
+	errNothingToProxy = errors.New("message has nothing that can be proxied")
 )
 
 func init() {
 	if len(botCommandPrefix) == 0 {
 		botCommandPrefix = "!"
 	}
+	if expiry := os.Getenv("BIND_REQUEST_EXPIRY"); len(expiry) > 0 {
+		duration, err := time.ParseDuration(expiry)
+		if err != nil || duration <= 0 {
+			panic("invalid BIND_REQUEST_EXPIRY: " + expiry)
+		}
+		bindRequestExpiry = duration
+	}
 }
 
 func main() {
@@ -37,8 +50,19 @@ func main() {
 		panic(err)
 	}
 	bot.AddHandler(HandleMessage)
-	_ = pendingBindRequests.StartJanitor()
-	defer pendingBindRequests.StopJanitor()
+	bot.AddHandler(HandleMessageUpdate)
+	bot.AddHandler(HandleMessageDelete)
+	bot.AddHandler(HandleMessageDeleteBulk)
+	bot.AddHandler(HandleMessageReactionAdd)
+	bot.AddHandler(HandleMessageReactionRemove)
+	bot.AddHandler(HandleInteraction)
+	if err = registerApplicationCommands(bot); err != nil {
+		log.Println("[main] Failed to register slash commands:", err.Error())
+	}
+	go expireBindRequests(bot)
+	go autoclean(bot)
+	go runLockScheduler(bot)
+	go expireBridgeMutes(bot)
 	waitUntilTermination()
 }
 
@@ -60,7 +84,8 @@ func Connect(discordToken string) (*discordgo.Session, error) {
 }
 
 func HandleMessage(bot *discordgo.Session, message *discordgo.MessageCreate) {
-	if message.Author.Bot || message.Author.ID == bot.State.User.ID {
+	if message.Author.Bot || message.Author.ID == bot.State.User.ID || len(message.WebhookID) > 0 {
+		// Ignore messages from bots, including the ones sent through the webhooks used to proxy messages
 		return
 	}
 	if strings.HasPrefix(message.Content, botCommandPrefix) {
@@ -68,118 +93,546 @@ func HandleMessage(bot *discordgo.Session, message *discordgo.MessageCreate) {
 		query := strings.TrimSpace(strings.Replace(message.Content, botCommandPrefix+command, "", 1))
 		command = strings.ToLower(command)
 		log.Printf("[HandleMessage] channel=%s; command=%s; arguments=%s", message.ChannelID, command, query)
-		switch command {
-		case "bind":
-			HandleBind(bot, message.ChannelID, query)
-		case "unbind":
-			HandleUnbind(bot, message.ChannelID)
-		case "clear", "clean", "wipe", "nuke":
-			HandleClear(bot, message.Message, false)
-		case "clearother":
-			HandleClear(bot, message.Message, true)
-		case "lock":
-			HandleLock(bot, message.Message, false)
-		case "unlock":
-			HandleLock(bot, message.Message, true)
-		case "pull":
-			HandlePull(bot, message.Message)
-		}
+		runCommand(bot, message.Message, command, query)
 	} else {
-		if otherChannelID, err := database.GetOtherChannelIDFromConnection(message.ChannelID); err == nil {
-			if database.IsChannelLocked(otherChannelID) {
-				_ = bot.MessageReactionAdd(message.ChannelID, message.ID, "⌛")
-				log.Printf("[HandleMessage] Not proxying message from=%s to=%s because channel=%s is locked", message.ChannelID, otherChannelID, otherChannelID)
-				return
+		targetChannelIDs, err := database.GetTargetChannelIDs(message.ChannelID)
+		if err != nil {
+			log.Println("[HandleMessage] Failed to get target channel IDs:", err.Error())
+			return
+		}
+		var pending, failed, proxied, blocked, muted, rateLimited bool
+		for _, targetChannelID := range targetChannelIDs {
+			if mute := getBridgeMute(message.Message, targetChannelID); mute != nil {
+				log.Printf("[HandleMessage] Not proxying message from=%s to=%s because user=%s is muted", message.ChannelID, targetChannelID, message.Author.ID)
+				notifyMutedUser(bot, message.Message, targetChannelID, mute)
+				muted = true
+				continue
 			}
-			if err := proxyMessage(bot, message.Message, otherChannelID); err != nil {
-				_ = bot.MessageReactionAdd(message.ChannelID, message.ID, "❌")
-			} else {
-				_ = bot.MessageReactionAdd(message.ChannelID, message.ID, "✅")
+			// The rate limits are checked once the message is known to be proxied to the channel, so that the messages
+			// of a muted user don't count towards them
+			rateLimit := getRateLimit(targetChannelID, message.ChannelID)
+			wait, ok := takeRateLimitTokens(bot, message.Message, targetChannelID, rateLimit)
+			if !ok {
+				rateLimited = true
+				continue
 			}
-		} else {
-			if err != database.ErrNotFound {
-				log.Println("[HandleMessage] Failed to get otherChannelID:", err.Error())
+			if delayMessage(bot, message.Message, targetChannelID, wait) {
+				pending = true
+				continue
+			}
+			switch relayMessage(bot, message.Message, targetChannelID) {
+			case relayResultProxied:
+				proxied = true
+			case relayResultPending:
+				pending = true
+			case relayResultBlocked:
+				blocked = true
+			case relayResultFailed:
+				failed = true
 			}
 		}
+		if muted {
+			_ = bot.MessageReactionAdd(message.ChannelID, message.ID, mutedEmoji)
+		}
+		if rateLimited {
+			_ = bot.MessageReactionAdd(message.ChannelID, message.ID, rateLimitedEmoji)
+		}
+		if pending {
+			_ = bot.MessageReactionAdd(message.ChannelID, message.ID, "⌛")
+		}
+		if failed || blocked {
+			_ = bot.MessageReactionAdd(message.ChannelID, message.ID, "❌")
+		} else if proxied {
+			_ = bot.MessageReactionAdd(message.ChannelID, message.ID, "✅")
+		}
+	}
+}
+
+type relayResult int
+
+const (
+	relayResultProxied relayResult = iota
+	// relayResultPending is the result of relaying a message that was held or submitted for review
+	relayResultPending
+	relayResultBlocked
+	relayResultFailed
+	// relayResultNothingToProxy is the result of relaying a message that has nothing that can be proxied, which is
+	// neither marked as proxied nor as failed
+	relayResultNothingToProxy
+)
+
+// relayMessage sends a message to a target channel once it passed the mutes and rate limits of the binding, which means
+// proxying it, unless it matches a filter rule, the target channel is locked or the message must be reviewed first
+func relayMessage(bot *discordgo.Session, message *discordgo.Message, targetChannelID string) relayResult {
+	if rule, _ := filterContent(message.ChannelID, targetChannelID, message.Content); rule != nil {
+		held, err := handleFilteredMessage(bot, message, targetChannelID, rule)
+		if err != nil {
+			log.Printf("[relayMessage] Failed to filter message from=%s to=%s: %s", message.ChannelID, targetChannelID, err.Error())
+		}
+		if held && err == nil {
+			return relayResultPending
+		}
+		return relayResultBlocked
 	}
+	if database.IsLocked(message.ChannelID, targetChannelID) {
+		log.Printf("[relayMessage] Holding message from=%s to=%s because channel=%s is locked", message.ChannelID, targetChannelID, targetChannelID)
+		err := database.HoldMessage(&database.HeldMessage{SourceChannelID: message.ChannelID, SourceMessageID: message.ID, TargetChannelID: targetChannelID, CreatedAt: time.Now()})
+		if err != nil {
+			log.Printf("[relayMessage] Failed to hold message from=%s to=%s: %s", message.ChannelID, targetChannelID, err.Error())
+			return relayResultFailed
+		}
+		return relayResultPending
+	}
+	if reviewChannelID := database.GetReviewChannelID(message.ChannelID, targetChannelID); len(reviewChannelID) > 0 {
+		if err := submitForReview(bot, message, targetChannelID, reviewChannelID); err != nil {
+			log.Printf("[relayMessage] Failed to submit message from=%s to=%s for review: %s", message.ChannelID, targetChannelID, err.Error())
+			return relayResultFailed
+		}
+		return relayResultPending
+	}
+	if err := proxyMessage(bot, message, targetChannelID); err == errNothingToProxy {
+		log.Printf("[relayMessage] Not proxying message=%s from=%s because it has nothing that can be proxied", message.ID, message.ChannelID)
+		return relayResultNothingToProxy
+	} else if err != nil {
+		log.Printf("[relayMessage] Failed to proxy message from=%s to=%s: %s", message.ChannelID, targetChannelID, err.Error())
+		return relayResultFailed
+	}
+	return relayResultProxied
 }
 
-func HandlePull(bot *discordgo.Session, message *discordgo.Message) {
-	destinationChannelID := message.ChannelID
-	sourceChannelID, err := database.GetOtherChannelIDFromConnection(destinationChannelID)
+// runCommand runs a command after making sure that the author of the message is allowed to use it
+func runCommand(bot *discordgo.Session, message *discordgo.Message, command, query string) {
+	var roles []string
+	if message.Member != nil {
+		roles = message.Member.Roles
+	}
+	if allowed, requirement := canUseCommand(bot, message.GuildID, message.ChannelID, message.Author.ID, roles, command); !allowed {
+		log.Printf("[runCommand] user=%s is not allowed to use command=%s in channel=%s", message.Author.ID, command, message.ChannelID)
+		_ = sendEmbed(bot, message.ChannelID, "You are not allowed to use this command", requirement)
+		return
+	}
+	switch command {
+	case "bind":
+		HandleBind(bot, message.ChannelID, query)
+	case "unbind":
+		HandleUnbind(bot, message.ChannelID, query)
+	case "clear", "clean", "wipe", "nuke":
+		HandleClear(bot, message, message.ChannelID)
+	case "clearother":
+		otherChannelID := resolveConnectedChannelID(bot, message.ChannelID, query)
+		if len(otherChannelID) == 0 {
+			return
+		}
+		// The author must also be allowed to clear the other channel, which may belong to another server
+		if allowed, requirement := canUseCommandInOtherChannel(bot, otherChannelID, message.Author.ID, command); !allowed {
+			log.Printf("[runCommand] user=%s is not allowed to use command=%s in channel=%s", message.Author.ID, command, otherChannelID)
+			_ = sendEmbed(bot, message.ChannelID, "You are not allowed to use this command", requirement)
+			return
+		}
+		HandleClear(bot, message, otherChannelID)
+	case "lock":
+		HandleLock(bot, message, query, false)
+	case "unlock":
+		HandleLock(bot, message, query, true)
+	case "pull":
+		HandlePull(bot, message, query)
+	case "mentions":
+		HandleMentions(bot, message, query)
+	case "hub":
+		HandleHub(bot, message, query)
+	case "publish":
+		HandleSubscription(bot, message.ChannelID, query, true)
+	case "subscribe":
+		HandleSubscription(bot, message.ChannelID, query, false)
+	case "unsubscribe":
+		HandleUnsubscribe(bot, message.ChannelID, query)
+	case "status":
+		HandleStatus(bot, message.ChannelID)
+	case "requests":
+		HandleRequests(bot, message.ChannelID)
+	case "cancel":
+		HandleCancelRequest(bot, message.ChannelID, query)
+	case "resend":
+		HandleResendRequest(bot, message.ChannelID, query)
+	case "commandrole":
+		HandleCommandRole(bot, message, query)
+	case "autoclean":
+		HandleAutoclean(bot, message.ChannelID, query)
+	case "queue":
+		HandleQueue(bot, message.ChannelID)
+	case "schedule":
+		HandleLockSchedule(bot, message.ChannelID, query)
+	case "approval":
+		HandleApproval(bot, message, query)
+	case "filter":
+		HandleFilter(bot, message, query)
+	case "bridgemute":
+		HandleBridgeMute(bot, message, query, false)
+	case "bridgeban":
+		HandleBridgeMute(bot, message, query, true)
+	case "bridgeunmute", "bridgeunban":
+		HandleBridgeUnmute(bot, message, query)
+	case "bridgemutes", "bridgebans":
+		HandleBridgeMutes(bot, message.ChannelID)
+	case "ratelimit":
+		HandleRateLimit(bot, message.ChannelID, query)
+	}
+}
+
+// HandleMessageUpdate applies the changes made to a message to all of its copies
+func HandleMessageUpdate(bot *discordgo.Session, message *discordgo.MessageUpdate) {
+	if message.Author == nil || message.Author.Bot || len(message.WebhookID) > 0 || len(message.EditedTimestamp) == 0 {
+		// Updates without an author or an edited timestamp are caused by Discord (e.g. link previews), not by users
+		return
+	}
+	proxiedMessages, err := database.GetProxiedMessagesBySourceMessageID(message.ID)
 	if err != nil {
-		log.Println("[HandlePull] Unable to get other channel ID:", err.Error())
+		log.Println("[HandleMessageUpdate] Failed to get proxied messages:", err.Error())
 		return
 	}
-	messages, err := bot.ChannelMessages(sourceChannelID, 50, "", "", "")
-	var messagesToSend []*discordgo.Message
-	for _, m := range messages {
-		if m.Author.ID == bot.State.User.ID || strings.HasPrefix(m.Content, botCommandPrefix) {
-			// Ignore messages from bot & commands
+	proxiedMessagesByChannelID := make(map[string][]*database.ProxiedMessage)
+	for _, proxiedMessage := range proxiedMessages {
+		proxiedMessagesByChannelID[proxiedMessage.ProxyChannelID] = append(proxiedMessagesByChannelID[proxiedMessage.ProxyChannelID], proxiedMessage)
+	}
+	for channelID, proxiedMessageParts := range proxiedMessagesByChannelID {
+		if getBridgeMute(message.Message, channelID) != nil {
+			// Edits made by a muted user are not applied, so that messages sent before the mute can't be used to get around it
 			continue
 		}
-		pending := false
-		for _, reaction := range m.Reactions {
-			if reaction.Emoji.Name == "⌛" {
-				pending = true
-				break
+		if rule, _ := filterContent(message.ChannelID, channelID, message.Content); rule != nil {
+			// The message was edited to include content that must not be proxied, so the copy is deleted
+			for _, proxiedMessage := range proxiedMessageParts {
+				if err = deleteProxiedMessage(bot, proxiedMessage); err != nil {
+					log.Printf("[HandleMessageUpdate] Failed to delete proxied message=%s: %s", proxiedMessage.ProxyMessageID, err.Error())
+				}
+				_ = database.DeleteProxiedMessageByProxyMessageID(proxiedMessage.ProxyMessageID)
 			}
+			if held, err := handleFilteredMessage(bot, message.Message, channelID, rule); err != nil {
+				log.Printf("[HandleMessageUpdate] Failed to filter message from=%s to=%s: %s", message.ChannelID, channelID, err.Error())
+			} else if held {
+				_ = bot.MessageReactionAdd(message.ChannelID, message.ID, "⌛")
+			} else {
+				_ = bot.MessageReactionAdd(message.ChannelID, message.ID, "❌")
+			}
+			continue
 		}
-		if !pending {
+		log.Printf("[HandleMessageUpdate] Editing proxied message=%s in channel=%s", proxiedMessageParts[0].ProxyMessageID, channelID)
+		_, attachmentsToLink := splitAttachments(bot, message.Attachments, channelID)
+		content, _ := buildProxiedMessageContent(bot, message.Message, channelID, attachmentsToLink)
+		allowedMentionTypes := getAllowedMentionTypes(message.ChannelID, channelID)
+		content = neutralizeMentions(content, allowedMentionTypes)
+		embeds := buildProxiedMessageEmbeds(message.Message)
+		parts := splitMessageContent(content, getMaximumPartLength(message.Message))
+		for i, proxiedMessage := range proxiedMessageParts {
+			if i >= len(parts) {
+				// The message is shorter than it used to be, so this part is no longer needed
+				if err = deleteProxiedMessage(bot, proxiedMessage); err != nil {
+					log.Printf("[HandleMessageUpdate] Failed to delete proxied message=%s: %s", proxiedMessage.ProxyMessageID, err.Error())
+				}
+				_ = database.DeleteProxiedMessageByProxyMessageID(proxiedMessage.ProxyMessageID)
+				continue
+			}
+			var partEmbeds []*discordgo.MessageEmbed
+			if i == len(parts)-1 || i == len(proxiedMessageParts)-1 {
+				partEmbeds = embeds
+			}
+			if err = editProxiedMessage(bot, message.Message, proxiedMessage, parts[i], partEmbeds, allowedMentionTypes); err != nil {
+				log.Printf("[HandleMessageUpdate] Failed to edit proxied message=%s: %s", proxiedMessage.ProxyMessageID, err.Error())
+			}
+		}
+		if len(parts) > len(proxiedMessageParts) {
+			// The message is longer than it used to be, so the parts that didn't exist before have to be sent, the same
+			// way as the parts that did, so that the copy doesn't switch between the webhook and the bot halfway through
+			useWebhook := len(proxiedMessageParts[len(proxiedMessageParts)-1].WebhookID) > 0
+			if err = sendProxiedMessageParts(bot, message.Message, channelID, parts[len(proxiedMessageParts):], len(proxiedMessageParts), nil, nil, nil, useWebhook, allowedMentionTypes); err != nil {
+				log.Printf("[HandleMessageUpdate] Failed to send new parts of proxied message in channel=%s: %s", channelID, err.Error())
+			}
+		}
+	}
+}
+
+// editProxiedMessage edits a part of the copy of a message
+func editProxiedMessage(bot *discordgo.Session, message *discordgo.Message, proxiedMessage *database.ProxiedMessage, content string, embeds []*discordgo.MessageEmbed, allowedMentionTypes []discordgo.AllowedMentionType) error {
+	if len(proxiedMessage.WebhookID) > 0 {
+		return editWithWebhook(bot, proxiedMessage, &discordgo.WebhookParams{
+			Content:         content,
+			Embeds:          embeds,
+			AllowedMentions: buildAllowedMentions(allowedMentionTypes),
+		})
+	}
+	content = formatAuthor(message) + content
+	_, err := bot.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID:              proxiedMessage.ProxyMessageID,
+		Channel:         proxiedMessage.ProxyChannelID,
+		Content:         &content,
+		Embed:           firstEmbed(embeds),
+		AllowedMentions: buildAllowedMentions(allowedMentionTypes),
+	})
+	return err
+}
+
+// HandleMessageDelete deletes all copies of a message that has been deleted
+func HandleMessageDelete(bot *discordgo.Session, message *discordgo.MessageDelete) {
+	deleteProxiedMessages(bot, []string{message.ID})
+}
+
+// HandleMessageDeleteBulk deletes all copies of messages that have been deleted in bulk, such as by HandleClear
+func HandleMessageDeleteBulk(bot *discordgo.Session, messages *discordgo.MessageDeleteBulk) {
+	deleteProxiedMessages(bot, messages.Messages)
+}
+
+// deleteProxiedMessages deletes all copies of the messages passed as parameter
+func deleteProxiedMessages(bot *discordgo.Session, messageIDs []string) {
+	proxiedMessagesByChannelID := make(map[string][]*database.ProxiedMessage)
+	for _, messageID := range messageIDs {
+		// If the deleted message was a copy, there's no need to keep track of it anymore
+		_ = database.DeleteProxiedMessageByProxyMessageID(messageID)
+		// If the deleted message was waiting for a channel to be unlocked or for a moderator's approval, it must no
+		// longer be proxied
+		_ = database.DeleteHeldMessagesBySourceMessageID(messageID)
+		deleteReviews(bot, messageID)
+		proxiedMessages, err := database.GetProxiedMessagesBySourceMessageID(messageID)
+		if err != nil {
+			log.Println("[deleteProxiedMessages] Failed to get proxied messages:", err.Error())
 			continue
 		}
-		messagesToSend = append([]*discordgo.Message{m}, messagesToSend...)
+		for _, proxiedMessage := range proxiedMessages {
+			proxiedMessagesByChannelID[proxiedMessage.ProxyChannelID] = append(proxiedMessagesByChannelID[proxiedMessage.ProxyChannelID], proxiedMessage)
+		}
+		_ = database.DeleteProxiedMessagesBySourceMessageID(messageID)
 	}
-	for _, messageToSend := range messagesToSend {
-		if err := proxyMessage(bot, messageToSend, destinationChannelID); err != nil {
-			log.Println("[HandlePull] Unable to send message:", err.Error())
-			_ = bot.MessageReactionAdd(messageToSend.ChannelID, messageToSend.ID, "❌")
-		} else {
-			_ = bot.MessageReactionRemove(messageToSend.ChannelID, messageToSend.ID, "⌛", bot.State.User.ID)
-			_ = bot.MessageReactionAdd(messageToSend.ChannelID, messageToSend.ID, "✅")
+	for channelID, proxiedMessages := range proxiedMessagesByChannelID {
+		log.Printf("[deleteProxiedMessages] Deleting %d proxied message(s) in channel=%s", len(proxiedMessages), channelID)
+		// Messages can only be deleted in bulk in batches of maximumBulkDeleteMessages, and a message may have been
+		// split into several parts, so there can be more copies than that
+		for start := 0; start < len(proxiedMessages); start += maximumBulkDeleteMessages {
+			end := start + maximumBulkDeleteMessages
+			if end > len(proxiedMessages) {
+				end = len(proxiedMessages)
+			}
+			deleteProxiedMessageBatch(bot, channelID, proxiedMessages[start:end])
+		}
+	}
+}
+
+// deleteProxiedMessageBatch deletes up to maximumBulkDeleteMessages copies of messages in a channel in bulk, or one at
+// a time if they can't be deleted in bulk
+func deleteProxiedMessageBatch(bot *discordgo.Session, channelID string, proxiedMessages []*database.ProxiedMessage) {
+	if len(proxiedMessages) > 1 {
+		ids := make([]string, 0, len(proxiedMessages))
+		for _, proxiedMessage := range proxiedMessages {
+			ids = append(ids, proxiedMessage.ProxyMessageID)
+		}
+		err := bot.ChannelMessagesBulkDelete(channelID, ids)
+		if err == nil {
+			return
+		}
+		log.Println("[deleteProxiedMessageBatch] Failed to bulk delete messages, deleting them one at a time instead:", err.Error())
+	}
+	for _, proxiedMessage := range proxiedMessages {
+		if err := deleteProxiedMessage(bot, proxiedMessage); err != nil && !isRESTError(err, discordgo.ErrCodeUnknownMessage) {
+			log.Printf("[deleteProxiedMessageBatch] Failed to delete proxied message=%s: %s", proxiedMessage.ProxyMessageID, err.Error())
+		}
+	}
+}
+
+// deleteProxiedMessage deletes a copy of a message, using the webhook that sent it if possible, since deleting
+// messages through their webhook does not require the Manage Messages permission
+func deleteProxiedMessage(bot *discordgo.Session, proxiedMessage *database.ProxiedMessage) error {
+	if len(proxiedMessage.WebhookID) > 0 {
+		if err := deleteWithWebhook(bot, proxiedMessage); err == nil {
+			return nil
 		}
 	}
-	_ = bot.ChannelMessageDelete(message.ChannelID, message.ID)
+	return bot.ChannelMessageDelete(proxiedMessage.ProxyChannelID, proxiedMessage.ProxyMessageID)
 }
 
 func proxyMessage(bot *discordgo.Session, message *discordgo.Message, targetChannelID string) error {
+	attachmentsToUpload, attachmentsToLink := splitAttachments(bot, message.Attachments, targetChannelID)
+	var files []*attachmentFile
+	for _, attachment := range attachmentsToUpload {
+		file, err := downloadAttachment(attachment)
+		if err != nil {
+			log.Printf("[proxyMessage] Failed to download attachment=%s, linking it instead: %s", attachment.ID, err.Error())
+			attachmentsToLink = append(attachmentsToLink, attachment)
+			continue
+		}
+		files = append(files, file)
+	}
+	content, reference := buildProxiedMessageContent(bot, message, targetChannelID, attachmentsToLink)
+	allowedMentionTypes := getAllowedMentionTypes(message.ChannelID, targetChannelID)
+	content = neutralizeMentions(content, allowedMentionTypes)
+	embeds := buildProxiedMessageEmbeds(message)
+	if len(message.Content) == 0 && len(message.Attachments) == 0 && len(embeds) == 0 {
+		// The message appears to be empty, which is usually the case for messages with nothing but a sticker
+		stickerEmbeds, placeholder := buildStickerEmbedsAndContent(getStickers(bot, message))
+		embeds = append(embeds, stickerEmbeds...)
+		content += placeholder
+	}
+	if len(content) == 0 && len(files) == 0 && len(embeds) == 0 {
+		return errNothingToProxy
+	}
+	log.Printf("[proxyMessage] Proxying message from=%s to=%s", message.ChannelID, targetChannelID)
+	parts := splitMessageContent(content, getMaximumPartLength(message))
+	// Webhooks can't reply to messages, so replies have to be sent by the bot itself
+	return sendProxiedMessageParts(bot, message, targetChannelID, parts, 0, embeds, files, reference, reference == nil, allowedMentionTypes)
+}
+
+// sendProxiedMessageParts sends the parts of the copy of a message, starting with the part at index firstPartIndex,
+// and keeps track of each of them.
+// The parts are sent through a webhook if useWebhook is true, and by the bot otherwise or if the webhook fails.
+// Embeds and files are sent with the last part, so that they're displayed after the content.
+func sendProxiedMessageParts(bot *discordgo.Session, message *discordgo.Message, targetChannelID string, parts []string, firstPartIndex int, embeds []*discordgo.MessageEmbed, files []*attachmentFile, reference *discordgo.MessageReference, useWebhook bool, allowedMentionTypes []discordgo.AllowedMentionType) error {
+	for i, part := range parts {
+		var partEmbeds []*discordgo.MessageEmbed
+		var partFiles []*attachmentFile
+		if i == len(parts)-1 {
+			partEmbeds, partFiles = embeds, files
+		}
+		var proxiedMessage *discordgo.Message
+		var err error
+		if useWebhook {
+			proxiedMessage, err = sendWithWebhook(bot, targetChannelID, &discordgo.WebhookParams{
+				Content:         part,
+				Username:        getWebhookUsername(message),
+				AvatarURL:       message.Author.AvatarURL(""),
+				Embeds:          partEmbeds,
+				AllowedMentions: buildAllowedMentions(allowedMentionTypes),
+			}, partFiles)
+			if err != nil {
+				log.Printf("[sendProxiedMessageParts] Failed to proxy message to=%s through webhook, falling back to regular message: %s", targetChannelID, err.Error())
+				useWebhook = false
+			}
+		}
+		if !useWebhook {
+			// Every part sent by the bot is prefixed with the author, since the previous parts may have been sent
+			// through the webhook if it failed halfway through
+			messageSend := &discordgo.MessageSend{
+				Content:         formatAuthor(message) + part,
+				Embed:           firstEmbed(partEmbeds),
+				Files:           toDiscordFiles(partFiles),
+				AllowedMentions: buildAllowedMentions(allowedMentionTypes),
+			}
+			if firstPartIndex+i == 0 {
+				messageSend.Reference = reference
+			}
+			if proxiedMessage, err = bot.ChannelMessageSendComplex(targetChannelID, messageSend); err != nil {
+				return err
+			}
+		}
+		err = database.CreateProxiedMessage(&database.ProxiedMessage{
+			SourceChannelID: message.ChannelID,
+			SourceMessageID: message.ID,
+			ProxyChannelID:  targetChannelID,
+			ProxyMessageID:  proxiedMessage.ID,
+			WebhookID:       proxiedMessage.WebhookID,
+			Part:            firstPartIndex + i,
+		})
+		if err != nil {
+			log.Printf("[sendProxiedMessageParts] Failed to keep track of proxied message=%s: %s", proxiedMessage.ID, err.Error())
+		}
+	}
+	return nil
+}
+
+// getMaximumPartLength returns the maximum length of each part of the copy of a message, which leaves enough room
+// for the author's name in case the copy ends up being sent by the bot rather than through a webhook
+func getMaximumPartLength(message *discordgo.Message) int {
+	return maximumMessageLength - runeCount(formatAuthor(message))
+}
+
+// buildProxiedMessageContent returns the content of the copy of a message in the target channel, as well as the
+// reference to the message the copy must reply to, if any.
+//
+// Attachments are uploaded alongside the copy, except for those passed as attachmentsToLink, which are linked in
+// the content instead.
+func buildProxiedMessageContent(bot *discordgo.Session, message *discordgo.Message, targetChannelID string, attachmentsToLink []*discordgo.MessageAttachment) (string, *discordgo.MessageReference) {
 	var attachments string
-	for _, attachment := range message.Attachments {
+	for _, attachment := range attachmentsToLink {
 		attachments += " " + attachment.URL
 	}
 	if len(message.Content) > 0 {
 		attachments = " " + attachments
 	}
-	log.Printf("[proxyMessage] Proxying message from=%s to=%s", message.ChannelID, targetChannelID)
-	_, err := bot.ChannelMessageSend(targetChannelID, message.Content+attachments)
-	return err
+	_, content := filterContent(message.ChannelID, targetChannelID, message.Content)
+	content = translateMentions(bot, content, message, targetChannelID) + attachments
+	var reference *discordgo.MessageReference
+	if message.Type == discordgo.MessageTypeReply && message.MessageReference != nil {
+		if reference = getReplyReference(message.MessageReference, targetChannelID); reference == nil {
+			content = translateMentions(bot, buildReplyQuote(bot, message.MessageReference, targetChannelID), message, targetChannelID) + content
+		}
+	}
+	return content, reference
+}
+
+// formatAuthor returns a prefix identifying the author of a message, for copies that aren't sent through a webhook
+func formatAuthor(message *discordgo.Message) string {
+	return "**" + neutralizeMentions(getAuthorDisplayName(message), nil) + "**: "
 }
 
-func HandleLock(bot *discordgo.Session, message *discordgo.Message, unlock bool) {
+// HandleLock locks or unlocks a channel, which prevents messages from being proxied to it until it is unlocked.
+// If another channel is specified, only the binding with that channel is locked or unlocked.
+//
+// A lock can be given a duration (e.g. 2h), after which it's lifted automatically, and the held messages are pulled
+// as well if pull is passed as argument.
+func HandleLock(bot *discordgo.Session, message *discordgo.Message, query string, unlock bool) {
 	var action string
 	if unlock {
 		action = "unlock"
 	} else {
 		action = "lock"
 	}
-	err := database.LockChannel(message.ChannelID, unlock)
-	if err != nil {
-		_ = sendEmbed(bot, message.ChannelID, "Failed to "+action+" channel", err.Error())
+	var otherChannelID string
+	var duration time.Duration
+	var pull bool
+	for _, argument := range strings.Fields(query) {
+		if strings.ToLower(argument) == "pull" {
+			pull = true
+		} else if parsedDuration, err := parseDuration(strings.ToLower(argument)); err == nil {
+			if unlock {
+				_ = sendEmbed(bot, message.ChannelID, "Invalid arguments", "An unlock can't have a duration, lock the channel for a duration instead")
+				return
+			}
+			duration = parsedDuration
+		} else {
+			otherChannelID = parseChannelID(argument)
+		}
+	}
+	if pull && duration == 0 {
+		_ = sendEmbed(bot, message.ChannelID, "Invalid arguments", fmt.Sprintf("Messages can only be pulled when a lock with a duration expires (e.g. `%slock 2h pull`), type `%spull` to pull them now", botCommandPrefix, botCommandPrefix))
 		return
 	}
-	_ = sendEmbed(bot, message.ChannelID, "Channel has been "+action+"ed", "")
+	subject := "Channel"
+	if len(otherChannelID) > 0 {
+		subject = "Binding with " + otherChannelID
+	}
+	if err := setLock(message.ChannelID, otherChannelID, unlock); err != nil {
+		_ = sendEmbed(bot, message.ChannelID, "Failed to "+action+" "+strings.ToLower(subject), err.Error())
+		return
+	}
+	// A lock that is lifted or replaced by hand must not be lifted automatically anymore
+	if err := database.DeleteLockTimer(message.ChannelID, otherChannelID); err != nil {
+		log.Printf("[HandleLock] Failed to delete lock timer of channel=%s: %s", message.ChannelID, err.Error())
+	}
+	if duration > 0 {
+		timer := &database.LockTimer{ChannelID: message.ChannelID, OtherChannelID: otherChannelID, UnlockAt: time.Now().Add(duration), Pull: pull}
+		if err := database.SetLockTimer(timer); err != nil {
+			_ = sendEmbed(bot, message.ChannelID, subject+" has been locked, but it will not be unlocked automatically", "```"+err.Error()+"```")
+			return
+		}
+		_ = sendEmbed(bot, message.ChannelID, subject+" has been locked for "+formatDuration(duration), describeLockTimers([]*database.LockTimer{timer}))
+		return
+	}
+	_ = sendEmbed(bot, message.ChannelID, subject+" has been "+action+"ed", "")
 }
 
-func HandleClear(bot *discordgo.Session, message *discordgo.Message, target bool) {
+// HandleClear deletes the messages in the channel passed as parameter, which is either the channel in which the
+// command was sent, or a channel bound to it
+func HandleClear(bot *discordgo.Session, message *discordgo.Message, channelID string) {
 	var err error
 	var messages []*discordgo.Message
-	if target {
-		otherChannelId, err := database.GetOtherChannelIDFromConnection(message.ChannelID)
-		if err != nil {
-			log.Println("[HandleClear] Unable to get other channel ID:", err.Error())
-			return
-		}
-		messages, err = bot.ChannelMessages(otherChannelId, 99, "", "", "")
+	if channelID != message.ChannelID {
+		messages, err = bot.ChannelMessages(channelID, 99, "", "", "")
 	} else {
 		messages, err = bot.ChannelMessages(message.ChannelID, 99, message.ID, "", "")
 	}
@@ -191,31 +644,47 @@ func HandleClear(bot *discordgo.Session, message *discordgo.Message, target bool
 		return
 	}
 	ids := make([]string, 0, len(messages)+1)
-	ids = append(ids, message.ID)
+	if channelID == message.ChannelID && len(message.ID) > 0 {
+		// Delete the command as well, unless it was a slash command
+		ids = append(ids, message.ID)
+	}
 	for _, m := range messages {
 		ids = append(ids, m.ID)
 	}
-	if err := bot.ChannelMessagesBulkDelete(messages[0].ChannelID, ids); err != nil {
+	// Deleting these messages will trigger HandleMessageDeleteBulk, which will take care of deleting their copies
+	if err := deleteMessages(bot, channelID, ids); err != nil {
 		log.Println("[HandleClear] Failed to delete messages:", err.Error())
-		if strings.Contains(err.Error(), "can only bulk delete messages that are under 14 days old") {
-			// Try to delete them one at a time.
-			log.Println("[HandleClear] Deleting messages one at a time instead")
-			for _, id := range ids {
-				if err := bot.ChannelMessageDelete(messages[0].ChannelID, id); err != nil {
-					log.Println("[HandleClear] Failed to delete message:", err.Error())
-					if !strings.Contains(err.Error(), "Unknown Message") {
-						return
-					}
-				}
-			}
-		} else {
-			return
+		return
+	}
+	if len(messages) == 99 {
+		// If there's 99 results, there's probably more messages left to delete
+		HandleClear(bot, message, channelID)
+	}
+}
+
+// deleteMessages deletes messages in bulk, or one at a time if some of the messages are too old to be deleted in bulk
+func deleteMessages(bot *discordgo.Session, channelID string, ids []string) error {
+	for len(ids) > maximumBulkDeleteMessages {
+		// Discord only allows deleting up to maximumBulkDeleteMessages messages at once
+		if err := deleteMessages(bot, channelID, ids[:maximumBulkDeleteMessages]); err != nil {
+			return err
 		}
+		ids = ids[maximumBulkDeleteMessages:]
+	}
+	err := bot.ChannelMessagesBulkDelete(channelID, ids)
+	if err == nil {
+		return nil
 	}
-	if len(ids) == 100 {
-		// If there's 100 results, there's probably more messages left to delete
-		HandleClear(bot, message, target)
+	if !strings.Contains(err.Error(), "can only bulk delete messages that are under 14 days old") {
+		return err
 	}
+	log.Println("[deleteMessages] Some messages are too old to be deleted in bulk, deleting messages one at a time instead")
+	for _, id := range ids {
+		if err := bot.ChannelMessageDelete(channelID, id); err != nil && !strings.Contains(err.Error(), "Unknown Message") {
+			return err
+		}
+	}
+	return nil
 }
 
 func HandleBind(bot *discordgo.Session, fromChannelID, toChannelID string) {
@@ -224,38 +693,154 @@ func HandleBind(bot *discordgo.Session, fromChannelID, toChannelID string) {
 		return
 	}
 	// Check if the target has already sent a binding request
-	_, exists := pendingBindRequests.Get(toChannelID + "-" + fromChannelID)
-	if exists {
-		pendingBindRequests.Delete(toChannelID + "-" + fromChannelID)
+	if err := database.ConsumeBindRequest(database.RequestTypeBind, toChannelID, fromChannelID); err == nil {
 		// Since a binding request originating from toChannelID has already been sent targeting fromChannelID,
 		// both parties have agreed therefore the connection has been established
-		_ = sendEmbed(bot, fromChannelID, "Connection successfully established with "+toChannelID, "")
-		_ = sendEmbed(bot, toChannelID, "Connection successfully established with "+fromChannelID, "")
-		if err := database.CreateConnection(fromChannelID, toChannelID); err == nil {
-			log.Println("[HandleBind] Created connection between", fromChannelID, "and", toChannelID)
-		} else {
+		if err := database.CreateConnection(fromChannelID, toChannelID); err != nil {
 			log.Printf("[HandleBind] Failed to create connection between %s and %s: %s", fromChannelID, toChannelID, err.Error())
+			_ = sendEmbed(bot, fromChannelID, "Failed to establish connection with "+toChannelID, "```"+err.Error()+"```")
+			return
 		}
+		log.Println("[HandleBind] Created connection between", fromChannelID, "and", toChannelID)
+		_ = sendEmbed(bot, fromChannelID, "Connection successfully established with "+toChannelID, "")
+		_ = sendEmbed(bot, toChannelID, "Connection successfully established with "+fromChannelID, "")
 		return
 	}
-	err := sendEmbed(bot, toChannelID, "Binding request from "+fromChannelID, fmt.Sprintf("You have 60 seconds to reply `%sbind %s`", botCommandPrefix, fromChannelID))
+	err := sendBindRequest(bot, newBindRequest(database.RequestTypeBind, fromChannelID, toChannelID))
 	if err != nil {
 		_ = sendEmbed(bot, fromChannelID, "Failed to send binding request", "```"+err.Error()+"```")
 		return
 	}
-	pendingBindRequests.SetWithTTL(fromChannelID+"-"+toChannelID, "BINDING_REQUEST", time.Minute)
 	_ = sendEmbed(bot, fromChannelID, "Binding request sent", "")
 }
 
-func HandleUnbind(bot *discordgo.Session, channelID string) {
-	err := database.DeleteConnectionByChannelID(channelID)
+// HandleUnbind deletes the binding between a channel and another channel.
+// The other channel may be omitted if the channel is only bound to one channel.
+func HandleUnbind(bot *discordgo.Session, channelID, otherChannel string) {
+	otherChannelID := resolveConnectedChannelID(bot, channelID, otherChannel)
+	if len(otherChannelID) == 0 {
+		return
+	}
+	err := database.DeleteConnection(channelID, otherChannelID)
 	if err != nil {
-		_ = sendEmbed(bot, channelID, "Failed to unbind channel", "```"+err.Error()+"```")
+		if err == database.ErrNotFound {
+			_ = sendEmbed(bot, channelID, "Channel is not bound to "+otherChannelID, "")
+		} else {
+			_ = sendEmbed(bot, channelID, "Failed to unbind channel", "```"+err.Error()+"```")
+		}
 		return
 	}
 	_ = sendEmbed(bot, channelID, "Channel unbound successfully", "")
 }
 
+// resolveConnectedChannelID returns the ID of the channel passed as argument if it is bound to the channel passed as
+// parameter, or the ID of the only channel bound to the channel passed as parameter if no argument was passed.
+// If no such channel can be resolved, the user is told so and an empty string is returned.
+func resolveConnectedChannelID(bot *discordgo.Session, channelID, argument string) string {
+	connectedChannelIDs, err := database.GetConnectedChannelIDs(channelID)
+	if err != nil {
+		log.Println("[resolveConnectedChannelID] Failed to get connected channel IDs:", err.Error())
+		return ""
+	}
+	if len(argument) > 0 {
+		if otherChannelID := parseChannelID(argument); contains(connectedChannelIDs, otherChannelID) {
+			return otherChannelID
+		}
+		_ = sendEmbed(bot, channelID, "Channel is not bound to "+parseChannelID(argument), "")
+		return ""
+	}
+	switch len(connectedChannelIDs) {
+	case 0:
+		_ = sendEmbed(bot, channelID, "Channel is not bound", "")
+		return ""
+	case 1:
+		return connectedChannelIDs[0]
+	default:
+		_ = sendEmbed(bot, channelID, "Channel is bound to several channels", "Please specify which channel:\n"+describeChannels(bot, connectedChannelIDs))
+		return ""
+	}
+}
+
+// resolveLinkedChannelID returns the ID of the channel passed as argument if messages are proxied between it and the
+// channel passed as parameter, or the ID of the only channel messages are proxied to or from if no argument was passed.
+// Unlike resolveConnectedChannelID, any type of connection is taken into account, including hubs and one-way
+// connections.
+// If no such channel can be resolved, the user is told so and an empty string is returned.
+func resolveLinkedChannelID(bot *discordgo.Session, channelID, argument string) string {
+	linkedChannelIDs, err := database.GetLinkedChannelIDs(channelID)
+	if err != nil {
+		log.Println("[resolveLinkedChannelID] Failed to get linked channel IDs:", err.Error())
+		return ""
+	}
+	if len(argument) > 0 {
+		if otherChannelID := parseChannelID(argument); contains(linkedChannelIDs, otherChannelID) {
+			return otherChannelID
+		}
+		_ = sendEmbed(bot, channelID, "Channel is not bound to "+parseChannelID(argument), "")
+		return ""
+	}
+	switch len(linkedChannelIDs) {
+	case 0:
+		_ = sendEmbed(bot, channelID, "Channel is not bound", "")
+		return ""
+	case 1:
+		return linkedChannelIDs[0]
+	default:
+		_ = sendEmbed(bot, channelID, "Channel is bound to several channels", "Please specify which channel:\n"+describeChannels(bot, linkedChannelIDs))
+		return ""
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDuration parses a duration such as 30m, 2h or 7d.
+// Unlike time.ParseDuration, this supports days as a unit.
+func parseDuration(value string) (time.Duration, error) {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("invalid duration %s", value)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// formatDuration formats a duration without the units that are zero (e.g. 2h rather than 2h0m0s)
+func formatDuration(duration time.Duration) string {
+	if duration >= 24*time.Hour && duration%(24*time.Hour) == 0 {
+		return strconv.Itoa(int(duration/(24*time.Hour))) + "d"
+	}
+	formatted := duration.String()
+	if strings.HasSuffix(formatted, "m0s") {
+		formatted = strings.TrimSuffix(formatted, "0s")
+	}
+	if strings.HasSuffix(formatted, "h0m") {
+		formatted = strings.TrimSuffix(formatted, "0m")
+	}
+	return formatted
+}
+
+// parseChannelID returns the ID of a channel passed either as an ID or as a mention (e.g. <#123>)
+func parseChannelID(argument string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(argument), "<#"), ">")
+}
+
+// getChannel returns a channel from the state cache, or from the API if the channel isn't in the cache
+func getChannel(bot *discordgo.Session, channelID string) (*discordgo.Channel, error) {
+	if channel, err := bot.State.Channel(channelID); err == nil {
+		return channel, nil
+	}
+	return bot.Channel(channelID)
+}
+
 func sendEmbed(bot *discordgo.Session, channelID, title, description string) error {
 	_, err := bot.ChannelMessageSendEmbed(channelID, &discordgo.MessageEmbed{
 		Title:       title,
@@ -263,3 +848,20 @@ func sendEmbed(bot *discordgo.Session, channelID, title, description string) err
 	})
 	return err
 }
+
+// joinEmbedLines joins lines into the description of an embed, leaving out the lines that would make the description
+// longer than Discord allows, in which case the description ends with how many lines were left out
+func joinEmbedLines(lines []string) string {
+	if description := strings.Join(lines, "\n"); runeCount(description) <= maximumEmbedDescriptionLength {
+		return description
+	}
+	var description string
+	for i, line := range lines {
+		omitted := fmt.Sprintf("…and %d more", len(lines)-i)
+		if runeCount(description)+runeCount(line)+1+runeCount(omitted) > maximumEmbedDescriptionLength {
+			return description + omitted
+		}
+		description += line + "\n"
+	}
+	return description
+}
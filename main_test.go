@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	scenarios := []struct {
+		value            string
+		expectedDuration time.Duration
+		expectedErr      bool
+	}{
+		{value: "30s", expectedDuration: 30 * time.Second},
+		{value: "30m", expectedDuration: 30 * time.Minute},
+		{value: "2h", expectedDuration: 2 * time.Hour},
+		{value: "1h30m", expectedDuration: 90 * time.Minute},
+		{value: "7d", expectedDuration: 7 * 24 * time.Hour},
+		{value: "0d", expectedDuration: 0},
+		{value: "-1d", expectedErr: true},
+		{value: "1.5d", expectedErr: true},
+		{value: "d", expectedErr: true},
+		{value: "tomorrow", expectedErr: true},
+		{value: "", expectedErr: true},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.value, func(t *testing.T) {
+			duration, err := parseDuration(scenario.value)
+			if scenario.expectedErr {
+				if err == nil {
+					t.Errorf("expected an error, got %s", duration)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("expected no error, got", err.Error())
+			}
+			if duration != scenario.expectedDuration {
+				t.Errorf("expected %s, got %s", scenario.expectedDuration, duration)
+			}
+		})
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	scenarios := []struct {
+		duration time.Duration
+		expected string
+	}{
+		{duration: 45 * time.Second, expected: "45s"},
+		{duration: 30 * time.Minute, expected: "30m"},
+		{duration: 2 * time.Hour, expected: "2h"},
+		{duration: 90 * time.Minute, expected: "1h30m"},
+		{duration: time.Hour + 30*time.Second, expected: "1h0m30s"},
+		{duration: 36 * time.Hour, expected: "36h"},
+		{duration: 7 * 24 * time.Hour, expected: "7d"},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.expected, func(t *testing.T) {
+			if formatted := formatDuration(scenario.duration); formatted != scenario.expected {
+				t.Errorf("expected %s, got %s", scenario.expected, formatted)
+			}
+		})
+	}
+}
+
+func TestFormatDurationParsesBack(t *testing.T) {
+	for _, duration := range []time.Duration{45 * time.Second, 30 * time.Minute, 90 * time.Minute, 36 * time.Hour, 14 * 24 * time.Hour} {
+		parsed, err := parseDuration(formatDuration(duration))
+		if err != nil || parsed != duration {
+			t.Errorf("expected %s to be parsed back from %s, got %s", duration, formatDuration(duration), parsed)
+		}
+	}
+}
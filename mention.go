@@ -0,0 +1,250 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/TwiN/discord-channel-proxy-bot/database"
+	"github.com/bwmarrin/discordgo"
+)
+
+const zeroWidthSpace = "\u200b"
+
+var (
+	massMentionRegex    = regexp.MustCompile(`@(everyone|here)`)
+	roleMentionRegex    = regexp.MustCompile(`<@&(\d+)>`)
+	userMentionRegex    = regexp.MustCompile(`<@!?(\d+)>`)
+	channelMentionRegex = regexp.MustCompile(`<#(\d+)>`)
+	customEmojiRegex    = regexp.MustCompile(`<a?:(\w+):(\d+)>`)
+	channelIDRegex      = regexp.MustCompile(`^(\d+|<#\d+>)$`)
+
+	// defaultAllowedMentionTypes are the types of mentions allowed for connections that haven't been configured
+	defaultAllowedMentionTypes = []discordgo.AllowedMentionType{discordgo.AllowedMentionTypeUsers}
+)
+
+// getAllowedMentionTypes returns the types of mentions allowed in messages proxied from the source channel to the
+// target channel
+func getAllowedMentionTypes(sourceChannelID, targetChannelID string) []discordgo.AllowedMentionType {
+	allowedMentions, err := database.GetAllowedMentions(sourceChannelID, targetChannelID)
+	if err != nil {
+		if err != database.ErrNotFound {
+			log.Println("[getAllowedMentionTypes] Failed to get allowed mentions:", err.Error())
+		}
+		return defaultAllowedMentionTypes
+	}
+	allowedMentionTypes := make([]discordgo.AllowedMentionType, 0, len(allowedMentions))
+	for _, allowedMention := range allowedMentions {
+		allowedMentionTypes = append(allowedMentionTypes, discordgo.AllowedMentionType(allowedMention))
+	}
+	return allowedMentionTypes
+}
+
+// buildAllowedMentions returns the allowed mentions that must be set on a proxied message
+func buildAllowedMentions(allowedMentionTypes []discordgo.AllowedMentionType) *discordgo.MessageAllowedMentions {
+	// Parse must never be nil, otherwise Discord would fall back to allowing all mentions
+	parse := make([]discordgo.AllowedMentionType, len(allowedMentionTypes))
+	copy(parse, allowedMentionTypes)
+	return &discordgo.MessageAllowedMentions{Parse: parse}
+}
+
+// neutralizeMentions breaks the syntax of the mentions that are not allowed, so that they're displayed as plain text
+// rather than being resolved by Discord
+func neutralizeMentions(content string, allowedMentionTypes []discordgo.AllowedMentionType) string {
+	if !isMentionTypeAllowed(allowedMentionTypes, discordgo.AllowedMentionTypeEveryone) {
+		content = massMentionRegex.ReplaceAllString(content, "@"+zeroWidthSpace+"$1")
+	}
+	if !isMentionTypeAllowed(allowedMentionTypes, discordgo.AllowedMentionTypeRoles) {
+		content = roleMentionRegex.ReplaceAllString(content, "<@"+zeroWidthSpace+"&$1>")
+	}
+	return content
+}
+
+func isMentionTypeAllowed(allowedMentionTypes []discordgo.AllowedMentionType, mentionType discordgo.AllowedMentionType) bool {
+	for _, allowedMentionType := range allowedMentionTypes {
+		if allowedMentionType == mentionType {
+			return true
+		}
+	}
+	return false
+}
+
+// translateMentions rewrites the user, role, channel and custom emoji mentions of a message that would not be
+// resolved in the target channel's guild into readable text (e.g. @alice, #general, :emoji:).
+// Mentions that can be resolved in the target channel's guild are left untouched.
+func translateMentions(bot *discordgo.Session, content string, message *discordgo.Message, targetChannelID string) string {
+	var sourceGuildID, targetGuildID string
+	if channel, err := getChannel(bot, message.ChannelID); err == nil {
+		sourceGuildID = channel.GuildID
+	}
+	if channel, err := getChannel(bot, targetChannelID); err == nil {
+		targetGuildID = channel.GuildID
+	}
+	content = userMentionRegex.ReplaceAllStringFunc(content, func(mention string) string {
+		userID := userMentionRegex.FindStringSubmatch(mention)[1]
+		if isGuildMember(bot, targetGuildID, userID) {
+			return mention
+		}
+		if name := getUserDisplayName(bot, message, sourceGuildID, userID); len(name) > 0 {
+			return "@" + name
+		}
+		return mention
+	})
+	content = roleMentionRegex.ReplaceAllStringFunc(content, func(mention string) string {
+		roleID := roleMentionRegex.FindStringSubmatch(mention)[1]
+		if role := getRole(bot, sourceGuildID, roleID); role != nil {
+			return "@" + role.Name
+		}
+		return mention
+	})
+	content = channelMentionRegex.ReplaceAllStringFunc(content, func(mention string) string {
+		channel, err := getChannel(bot, channelMentionRegex.FindStringSubmatch(mention)[1])
+		if err != nil || channel.GuildID == targetGuildID {
+			return mention
+		}
+		return "#" + channel.Name
+	})
+	return customEmojiRegex.ReplaceAllStringFunc(content, func(mention string) string {
+		submatches := customEmojiRegex.FindStringSubmatch(mention)
+		if canUseEmoji(bot, submatches[2]) {
+			return mention
+		}
+		return ":" + submatches[1] + ":"
+	})
+}
+
+// isGuildMember checks whether a user is a member of a guild
+func isGuildMember(bot *discordgo.Session, guildID, userID string) bool {
+	if len(guildID) == 0 {
+		return false
+	}
+	if _, err := bot.State.Member(guildID, userID); err == nil {
+		return true
+	}
+	_, err := bot.GuildMember(guildID, userID)
+	return err == nil
+}
+
+// getUserDisplayName returns the nickname of a user in the source guild if there is one, or the username otherwise
+func getUserDisplayName(bot *discordgo.Session, message *discordgo.Message, sourceGuildID, userID string) string {
+	if member, err := bot.State.Member(sourceGuildID, userID); err == nil {
+		if len(member.Nick) > 0 {
+			return member.Nick
+		}
+		if member.User != nil {
+			return member.User.Username
+		}
+	}
+	for _, user := range message.Mentions {
+		if user.ID == userID {
+			return user.Username
+		}
+	}
+	if user, err := bot.User(userID); err == nil {
+		return user.Username
+	}
+	return ""
+}
+
+// getRole returns a role from a guild, or nil if the role could not be found
+func getRole(bot *discordgo.Session, guildID, roleID string) *discordgo.Role {
+	if len(guildID) == 0 {
+		return nil
+	}
+	if role, err := bot.State.Role(guildID, roleID); err == nil {
+		return role
+	}
+	roles, err := bot.GuildRoles(guildID)
+	if err != nil {
+		return nil
+	}
+	for _, role := range roles {
+		if role.ID == roleID {
+			return role
+		}
+	}
+	return nil
+}
+
+// canUseEmoji checks whether a custom emoji belongs to one of the guilds the bot is in
+func canUseEmoji(bot *discordgo.Session, emojiID string) bool {
+	bot.State.RLock()
+	defer bot.State.RUnlock()
+	for _, guild := range bot.State.Guilds {
+		for _, emoji := range guild.Emojis {
+			if emoji.ID == emojiID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HandleMentions shows or configures which types of mentions are allowed in messages proxied to the channel in which
+// the command was sent through one of its bindings, or through the hub it's a member of if it isn't bound to any
+// channel. Only the channel that receives the messages can allow mentions in them.
+// If the channel has several bindings, the channel of the binding must be passed as first argument.
+func HandleMentions(bot *discordgo.Session, message *discordgo.Message, query string) {
+	arguments := strings.Fields(strings.ToLower(query))
+	var otherChannelID, hubName string
+	var err error
+	connectedChannelIDs, _ := database.GetConnectedChannelIDs(message.ChannelID)
+	if len(arguments) > 0 && channelIDRegex.MatchString(arguments[0]) {
+		otherChannelID = parseChannelID(arguments[0])
+		arguments = arguments[1:]
+	} else if len(connectedChannelIDs) > 0 {
+		if otherChannelID = resolveConnectedChannelID(bot, message.ChannelID, ""); len(otherChannelID) == 0 {
+			return
+		}
+	} else {
+		if hubName, err = database.GetHubNameByChannelID(message.ChannelID); err != nil {
+			_ = sendEmbed(bot, message.ChannelID, "Channel is not bound", "")
+			return
+		}
+		hubChannelIDs, _ := database.GetHubChannelIDs(hubName)
+		for _, hubChannelID := range hubChannelIDs {
+			if hubChannelID != message.ChannelID {
+				otherChannelID = hubChannelID
+				break
+			}
+		}
+	}
+	if len(arguments) == 0 {
+		allowedMentionTypes := getAllowedMentionTypes(otherChannelID, message.ChannelID)
+		description := "none"
+		if len(allowedMentionTypes) > 0 {
+			description = ""
+			for _, allowedMentionType := range allowedMentionTypes {
+				description += "`" + string(allowedMentionType) + "` "
+			}
+		}
+		_ = sendEmbed(bot, message.ChannelID, "Allowed mentions in messages proxied to this channel", strings.TrimSpace(description))
+		return
+	}
+	var allowedMentions []string
+	for _, argument := range arguments {
+		switch discordgo.AllowedMentionType(argument) {
+		case discordgo.AllowedMentionTypeUsers, discordgo.AllowedMentionTypeRoles, discordgo.AllowedMentionTypeEveryone:
+			allowedMentions = append(allowedMentions, argument)
+		default:
+			if argument != "none" {
+				_ = sendEmbed(bot, message.ChannelID, "Invalid mention type: "+argument, "Valid mention types are `users`, `roles`, `everyone` and `none`")
+				return
+			}
+		}
+	}
+	if len(hubName) > 0 {
+		err = database.SetHubChannelAllowedMentions(message.ChannelID, allowedMentions)
+	} else {
+		err = database.SetAllowedMentions(message.ChannelID, otherChannelID, allowedMentions)
+	}
+	if err != nil {
+		if err == database.ErrNotFound {
+			_ = sendEmbed(bot, message.ChannelID, "Channel is not bound to "+otherChannelID, "")
+		} else {
+			_ = sendEmbed(bot, message.ChannelID, "Failed to update allowed mentions", "```"+err.Error()+"```")
+		}
+		return
+	}
+	_ = sendEmbed(bot, message.ChannelID, "Allowed mentions updated", "")
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TwiN/discord-channel-proxy-bot/database"
+	"github.com/bwmarrin/discordgo"
+)
+
+// mutedEmoji is the reaction added to a message that was not proxied because its author is muted from the binding
+const mutedEmoji = "🔇"
+
+// HandleBridgeMute mutes or bans a user from a binding of the channel in which the command was sent, which may be any
+// type of connection, including hubs and subscriptions, and prevents their messages and reactions from being proxied
+// through the binding in either direction.
+// A mute can expire after a duration, while a ban lasts until the user is unbanned.
+//
+// Usage: bridgemute @USER [DURATION] [CHANNEL_ID]
+//
+// Usage: bridgeban @USER [CHANNEL_ID]
+func HandleBridgeMute(bot *discordgo.Session, message *discordgo.Message, query string, banned bool) {
+	userID, duration, otherChannel, ok := parseBridgeMuteArguments(query)
+	if !ok || (banned && duration > 0) {
+		usage := fmt.Sprintf("Usage: `%sbridgemute @user [DURATION] [CHANNEL_ID]`", botCommandPrefix)
+		if banned {
+			usage = fmt.Sprintf("Usage: `%sbridgeban @user [CHANNEL_ID]`", botCommandPrefix)
+		}
+		_ = sendEmbed(bot, message.ChannelID, "Invalid arguments", usage)
+		return
+	}
+	if userID == bot.State.User.ID || userID == message.Author.ID {
+		_ = sendEmbed(bot, message.ChannelID, "You cannot mute this user", "")
+		return
+	}
+	otherChannelID := resolveLinkedChannelID(bot, message.ChannelID, otherChannel)
+	if len(otherChannelID) == 0 {
+		return
+	}
+	mute := &database.BridgeMute{ChannelID: message.ChannelID, OtherChannelID: otherChannelID, UserID: userID, Banned: banned, CreatedAt: time.Now()}
+	if duration > 0 {
+		mute.ExpiresAt = mute.CreatedAt.Add(duration)
+	}
+	if err := database.SetBridgeMute(mute); err != nil {
+		_ = sendEmbed(bot, message.ChannelID, "Failed to mute user", "```"+err.Error()+"```")
+		return
+	}
+	log.Printf("[HandleBridgeMute] Muted user=%s from binding between channel=%s and channel=%s; banned=%v; duration=%s", userID, message.ChannelID, otherChannelID, banned, duration)
+	title := "User muted"
+	if banned {
+		title = "User banned"
+	}
+	_ = sendEmbed(bot, message.ChannelID, title, "<@"+userID+">: "+describeBridgeMute(bot, mute))
+}
+
+// HandleBridgeUnmute lifts the mute or ban of a user from a binding of the channel in which the command was sent
+//
+// Usage: bridgeunmute @USER [CHANNEL_ID]
+func HandleBridgeUnmute(bot *discordgo.Session, message *discordgo.Message, query string) {
+	userID, duration, otherChannel, ok := parseBridgeMuteArguments(query)
+	if !ok || duration > 0 {
+		_ = sendEmbed(bot, message.ChannelID, "Invalid arguments", fmt.Sprintf("Usage: `%sbridgeunmute @user [CHANNEL_ID]`", botCommandPrefix))
+		return
+	}
+	// The channel of the binding isn't checked if it was passed, so that a mute can be lifted even if the channels are no
+	// longer bound
+	otherChannelID := parseChannelID(otherChannel)
+	if len(otherChannelID) == 0 {
+		if otherChannelID = resolveLinkedChannelID(bot, message.ChannelID, ""); len(otherChannelID) == 0 {
+			return
+		}
+	}
+	if err := database.DeleteBridgeMute(message.ChannelID, otherChannelID, userID); err != nil {
+		if err == database.ErrNotFound {
+			_ = sendEmbed(bot, message.ChannelID, "User is not muted", "Only mutes created from this channel can be lifted from this channel")
+		} else {
+			_ = sendEmbed(bot, message.ChannelID, "Failed to unmute user", "```"+err.Error()+"```")
+		}
+		return
+	}
+	_ = sendEmbed(bot, message.ChannelID, "User unmuted", "Messages from <@"+userID+"> are proxied to and from "+describeChannel(bot, otherChannelID)+" again")
+}
+
+// HandleBridgeMutes lists the users muted or banned from the bindings of the channel in which the command was sent
+func HandleBridgeMutes(bot *discordgo.Session, channelID string) {
+	mutes, err := database.GetBridgeMutesByChannelID(channelID)
+	if err != nil {
+		_ = sendEmbed(bot, channelID, "Failed to retrieve muted users", "```"+err.Error()+"```")
+		return
+	}
+	if len(mutes) == 0 {
+		_ = sendEmbed(bot, channelID, "No users are muted from the bindings of this channel", "")
+		return
+	}
+	var description string
+	for _, mute := range mutes {
+		description += "- <@" + mute.UserID + ">: " + describeBridgeMute(bot, mute)
+		if mute.ChannelID != channelID {
+			description += " (by the other channel)"
+		}
+		description += "\n"
+	}
+	_ = sendEmbed(bot, channelID, "Muted users", description)
+}
+
+// parseBridgeMuteArguments parses the user, the optional duration and the optional channel of the commands used to mute
+// and unmute users, and returns whether the arguments were valid
+func parseBridgeMuteArguments(query string) (userID string, duration time.Duration, otherChannel string, ok bool) {
+	arguments := strings.Fields(query)
+	if len(arguments) == 0 {
+		return "", 0, "", false
+	}
+	if userMentionRegex.MatchString(arguments[0]) {
+		userID = userMentionRegex.FindStringSubmatch(arguments[0])[1]
+	} else if _, err := strconv.ParseUint(arguments[0], 10, 64); err == nil {
+		userID = arguments[0]
+	} else {
+		return "", 0, "", false
+	}
+	for _, argument := range arguments[1:] {
+		if channelIDRegex.MatchString(argument) && len(otherChannel) == 0 {
+			otherChannel = argument
+		} else if value, err := parseDuration(strings.ToLower(argument)); err == nil && value >= time.Minute && duration == 0 {
+			duration = value
+		} else {
+			return "", 0, "", false
+		}
+	}
+	return userID, duration, otherChannel, true
+}
+
+func describeBridgeMute(bot *discordgo.Session, mute *database.BridgeMute) string {
+	binding := "the binding between " + describeChannel(bot, mute.ChannelID) + " and " + describeChannel(bot, mute.OtherChannelID)
+	if mute.Banned {
+		return "banned from " + binding
+	}
+	description := "muted from " + binding
+	if !mute.ExpiresAt.IsZero() {
+		description += fmt.Sprintf(" until <t:%d:f>", mute.ExpiresAt.Unix())
+	}
+	return description
+}
+
+// getBridgeMute returns the mute that prevents a message from being proxied to the target channel, or nil if the
+// author of the message isn't muted from the binding between the channel of the message and the target channel
+func getBridgeMute(message *discordgo.Message, targetChannelID string) *database.BridgeMute {
+	mute, err := database.GetBridgeMute(message.ChannelID, targetChannelID, message.Author.ID)
+	if err != nil {
+		if err != database.ErrNotFound {
+			log.Printf("[getBridgeMute] Failed to check whether user=%s is muted from channel=%s to channel=%s: %s", message.Author.ID, message.ChannelID, targetChannelID, err.Error())
+		}
+		return nil
+	}
+	return mute
+}
+
+// notifyMutedUser tells the author of a message that was not proxied because of a mute that their messages are not
+// being proxied, unless they were already told so for that mute
+func notifyMutedUser(bot *discordgo.Session, message *discordgo.Message, targetChannelID string, mute *database.BridgeMute) {
+	if mute.Notified {
+		return
+	}
+	description := "Your messages in <#" + message.ChannelID + "> are not being proxied to " + describeChannel(bot, targetChannelID)
+	if mute.Banned {
+		description += ", because you have been banned from this binding"
+	} else if !mute.ExpiresAt.IsZero() {
+		description += fmt.Sprintf(" until <t:%d:f>", mute.ExpiresAt.Unix())
+	}
+	if err := sendDirectMessage(bot, message.Author.ID, "You are muted", description); err != nil {
+		log.Printf("[notifyMutedUser] Failed to notify user=%s: %s", message.Author.ID, err.Error())
+	}
+	// The user is considered notified even if they couldn't be messaged, since the reaction on their message tells them
+	// as well
+	if err := database.SetBridgeMuteNotified(mute); err != nil {
+		log.Printf("[notifyMutedUser] Failed to mark mute of user=%s as notified: %s", message.Author.ID, err.Error())
+	}
+}
+
+// expireBridgeMutes periodically deletes the mutes that have expired, and tells the users who were told that they were
+// muted that their messages are proxied again
+func expireBridgeMutes(bot *discordgo.Session) {
+	for now := range time.Tick(time.Minute) {
+		mutes, err := database.DeleteExpiredBridgeMutes(now)
+		if err != nil {
+			log.Println("[expireBridgeMutes] Failed to delete expired mutes:", err.Error())
+			continue
+		}
+		for _, mute := range mutes {
+			if !mute.Notified {
+				continue
+			}
+			_ = sendDirectMessage(bot, mute.UserID, "You are no longer muted", "Your messages are proxied between "+describeChannel(bot, mute.ChannelID)+" and "+describeChannel(bot, mute.OtherChannelID)+" again")
+		}
+	}
+}
+
+func sendDirectMessage(bot *discordgo.Session, userID, title, description string) error {
+	channel, err := bot.UserChannelCreate(userID)
+	if err != nil {
+		return err
+	}
+	return sendEmbed(bot, channel.ID, title, description)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/TwiN/discord-channel-proxy-bot/database"
+	"github.com/bwmarrin/discordgo"
+)
+
+// commandPermissions is the permission required by default to use each command.
+// Commands that aren't in this map can be used by anyone.
+var commandPermissions = map[string]int64{
+	"bind":        discordgo.PermissionManageChannels,
+	"unbind":      discordgo.PermissionManageChannels,
+	"lock":        discordgo.PermissionManageChannels,
+	"unlock":      discordgo.PermissionManageChannels,
+	"schedule":    discordgo.PermissionManageChannels,
+	"approval":    discordgo.PermissionManageChannels,
+	"filter":      discordgo.PermissionManageChannels,
+	"ratelimit":   discordgo.PermissionManageChannels,
+	"mentions":    discordgo.PermissionManageChannels,
+	"hub":         discordgo.PermissionManageChannels,
+	"publish":     discordgo.PermissionManageChannels,
+	"subscribe":   discordgo.PermissionManageChannels,
+	"unsubscribe": discordgo.PermissionManageChannels,
+	"cancel":      discordgo.PermissionManageChannels,
+	"resend":      discordgo.PermissionManageChannels,
+	"clear":       discordgo.PermissionManageMessages,
+	"clearother":  discordgo.PermissionManageMessages,
+	"pull":        discordgo.PermissionManageMessages,
+	"autoclean":   discordgo.PermissionManageMessages,
+	"commandrole": discordgo.PermissionManageServer,
+
+	"bridgemute":   discordgo.PermissionManageMessages,
+	"bridgeban":    discordgo.PermissionManageMessages,
+	"bridgeunmute": discordgo.PermissionManageMessages,
+
+	// approve isn't a command, but the permission to approve or reject messages in approval mode
+	"approve": discordgo.PermissionManageMessages,
+}
+
+var permissionNames = map[int64]string{
+	discordgo.PermissionManageChannels: "Manage Channels",
+	discordgo.PermissionManageMessages: "Manage Messages",
+	discordgo.PermissionManageServer:   "Manage Server",
+}
+
+// commandAliases maps the aliases of a command to the name of the command, so that aliases share the same requirements
+var commandAliases = map[string]string{
+	"clean": "clear",
+	"wipe":  "clear",
+	"nuke":  "clear",
+
+	"bridgeunban": "bridgeunmute",
+	"bridgebans":  "bridgemutes",
+}
+
+func getCommandName(command string) string {
+	if name, ok := commandAliases[command]; ok {
+		return name
+	}
+	return command
+}
+
+// getMember returns a member of a guild, from the state if possible
+func getMember(bot *discordgo.Session, guildID, userID string) (*discordgo.Member, error) {
+	if member, err := bot.State.Member(guildID, userID); err == nil {
+		return member, nil
+	}
+	return bot.GuildMember(guildID, userID)
+}
+
+// canUseCommand checks whether a member is allowed to use a command in a channel.
+//
+// If the guild has configured a role for the command, the member must have that role, otherwise the member must have
+// the permission returned by commandPermissions. Administrators can use every command regardless.
+// If the member isn't allowed to use the command, the requirement that isn't met is returned.
+func canUseCommand(bot *discordgo.Session, guildID, channelID, userID string, roles []string, command string) (bool, string) {
+	command = getCommandName(command)
+	requiredPermission, restricted := commandPermissions[command]
+	if !restricted {
+		return true, ""
+	}
+	if len(guildID) == 0 {
+		return false, "This command can only be used in a server"
+	}
+	permissions, err := bot.UserChannelPermissions(userID, channelID)
+	if err != nil {
+		log.Printf("[canUseCommand] Failed to get permissions of user=%s in channel=%s: %s", userID, channelID, err.Error())
+		return false, "Unable to verify your permissions"
+	}
+	if permissions&discordgo.PermissionAdministrator != 0 {
+		return true, ""
+	}
+	if roleID, err := database.GetCommandRoleID(guildID, command); err == nil {
+		for _, role := range roles {
+			if role == roleID {
+				return true, ""
+			}
+		}
+		return false, "Requires the <@&" + roleID + "> role"
+	}
+	if permissions&requiredPermission == requiredPermission {
+		return true, ""
+	}
+	return false, "Requires the `" + permissionNames[requiredPermission] + "` permission"
+}
+
+// canUseCommandInOtherChannel checks whether a user is allowed to use a command in a channel other than the one in
+// which the command was sent, using the roles the user has in the guild of that channel.
+// This is required for commands that act on a bound channel, which may belong to another guild.
+func canUseCommandInOtherChannel(bot *discordgo.Session, channelID, userID, command string) (bool, string) {
+	channel, err := getChannel(bot, channelID)
+	if err != nil {
+		log.Printf("[canUseCommandInOtherChannel] Failed to get channel=%s: %s", channelID, err.Error())
+		return false, "Unable to verify your permissions in <#" + channelID + ">"
+	}
+	member, err := getMember(bot, channel.GuildID, userID)
+	if err != nil {
+		return false, "You must be a member of the server of <#" + channelID + ">"
+	}
+	if allowed, requirement := canUseCommand(bot, channel.GuildID, channelID, userID, member.Roles, command); !allowed {
+		return false, requirement + " in <#" + channelID + ">"
+	}
+	return true, ""
+}
+
+// HandleCommandRole shows or configures the roles required to use commands in the guild in which the command was sent.
+// The role replaces the permission that is required by default to use the command.
+func HandleCommandRole(bot *discordgo.Session, message *discordgo.Message, query string) {
+	arguments := strings.Fields(query)
+	if len(arguments) == 0 {
+		roleIDs, err := database.GetCommandRoleIDs(message.GuildID)
+		if err != nil {
+			_ = sendEmbed(bot, message.ChannelID, "Failed to retrieve command roles", "```"+err.Error()+"```")
+			return
+		}
+		var commands []string
+		for command := range commandPermissions {
+			commands = append(commands, command)
+		}
+		sort.Strings(commands)
+		var description string
+		for _, command := range commands {
+			if roleID, ok := roleIDs[command]; ok {
+				description += "`" + command + "`: <@&" + roleID + ">\n"
+			} else {
+				description += "`" + command + "`: " + permissionNames[commandPermissions[command]] + "\n"
+			}
+		}
+		_ = sendEmbed(bot, message.ChannelID, "Command requirements", description)
+		return
+	}
+	command := getCommandName(strings.ToLower(strings.TrimPrefix(arguments[0], botCommandPrefix)))
+	if _, restricted := commandPermissions[command]; !restricted {
+		_ = sendEmbed(bot, message.ChannelID, "Unknown command "+command, "Only commands that require a permission can be restricted to a role")
+		return
+	}
+	if len(arguments) == 1 || strings.ToLower(arguments[1]) == "none" {
+		if err := database.DeleteCommandRoleID(message.GuildID, command); err != nil {
+			_ = sendEmbed(bot, message.ChannelID, "Failed to reset required role", "```"+err.Error()+"```")
+			return
+		}
+		_ = sendEmbed(bot, message.ChannelID, "Command "+command+" now requires the `"+permissionNames[commandPermissions[command]]+"` permission", "")
+		return
+	}
+	roleID := strings.TrimSuffix(strings.TrimPrefix(arguments[1], "<@&"), ">")
+	if getRole(bot, message.GuildID, roleID) == nil {
+		_ = sendEmbed(bot, message.ChannelID, "Unknown role "+arguments[1], "")
+		return
+	}
+	if err := database.SetCommandRoleID(message.GuildID, command, roleID); err != nil {
+		_ = sendEmbed(bot, message.ChannelID, "Failed to set required role", "```"+err.Error()+"```")
+		return
+	}
+	_ = sendEmbed(bot, message.ChannelID, "Command "+command+" now requires a role", "Members with the <@&"+roleID+"> role can now use `"+botCommandPrefix+command+"`")
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/TwiN/discord-channel-proxy-bot/database"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// defaultPullCount is the number of messages pulled from history when neither a count, a starting message nor all
+	// is specified
+	defaultPullCount = 50
+
+	pullProgressInterval = 10
+)
+
+var messageLinkRegex = regexp.MustCompile(`^https://(?:(?:ptb|canary)\.)?discord(?:app)?\.com/channels/(?:\d+|@me)/(\d+)/(\d+)$`)
+
+// pullFilter describes which messages must be pulled from the history of the source channels
+type pullFilter struct {
+	// Count is the maximum number of messages pulled, or 0 if there's no limit
+	Count int
+
+	// AuthorID is the ID of the only user whose messages are pulled, or an empty string for all users
+	AuthorID string
+
+	// AfterID is the ID of the message after which messages are pulled, or an empty string to pull the most recent
+	// messages
+	AfterID string
+}
+
+type pullResult int
+
+const (
+	pullResultPulled pullResult = iota
+	pullResultSkipped
+	pullResultFailed
+
+	// pullResultEmpty is the result of pulling a message that has nothing that can be proxied, which is counted as
+	// skipped, but unlike other skipped messages, will never be proxied
+	pullResultEmpty
+
+	// pullResultBlocked is the result of pulling a message that matched a filter rule with the block action or whose
+	// author is muted from the binding, which is counted as skipped, and isn't pulled again either
+	pullResultBlocked
+)
+
+// pullProgress reports the progress of a pull in the channel messages are pulled into
+type pullProgress struct {
+	bot     *discordgo.Session
+	message *discordgo.Message
+	total   int
+
+	pulled, skipped, failed int
+
+	// kept is the number of held messages that were left in the queue to be pulled again later
+	kept int
+}
+
+// HandlePull proxies messages from the source channels of the channel in which the command was sent, and reports the
+// progress in the channel.
+//
+// Without arguments, the messages that were held while the channel was locked are pulled, in the order in which they
+// were sent. Otherwise, messages are pulled from the history of the source channels, which can be narrowed down with
+// the following arguments, in any order: a number of messages, a user mention, since followed by a message link or ID,
+// and all. Messages that have already been proxied to the channel are skipped either way.
+func HandlePull(bot *discordgo.Session, message *discordgo.Message, query string) {
+	if len(message.ID) > 0 {
+		_ = bot.ChannelMessageDelete(message.ChannelID, message.ID)
+	}
+	if len(strings.TrimSpace(query)) == 0 {
+		pullHeldMessages(bot, message.ChannelID, "")
+		return
+	}
+	filter, err := parsePullFilter(query)
+	if err != nil {
+		_ = sendEmbed(bot, message.ChannelID, "Invalid pull arguments", err.Error()+"\nUsage: `"+botCommandPrefix+"pull [COUNT] [@user] [since MESSAGE_LINK] [all]`")
+		return
+	}
+	pullHistory(bot, message.ChannelID, filter)
+}
+
+// parsePullFilter parses the arguments of the pull command.
+// If neither a count, a starting message nor all is specified, only the defaultPullCount most recent messages are
+// pulled.
+func parsePullFilter(query string) (*pullFilter, error) {
+	filter := &pullFilter{}
+	var all bool
+	arguments := strings.Fields(query)
+	for i := 0; i < len(arguments); i++ {
+		argument := strings.ToLower(arguments[i])
+		switch {
+		case argument == "all":
+			all = true
+		case argument == "since":
+			if i+1 == len(arguments) {
+				return nil, fmt.Errorf("since must be followed by a message link or ID")
+			}
+			i++
+			if matches := messageLinkRegex.FindStringSubmatch(arguments[i]); matches != nil {
+				filter.AfterID = matches[2]
+			} else if _, err := strconv.ParseUint(arguments[i], 10, 64); err == nil {
+				filter.AfterID = arguments[i]
+			} else {
+				return nil, fmt.Errorf("invalid message link %s", arguments[i])
+			}
+		case userMentionRegex.MatchString(argument):
+			filter.AuthorID = userMentionRegex.FindStringSubmatch(argument)[1]
+		default:
+			count, err := strconv.Atoi(argument)
+			if err != nil || count <= 0 {
+				return nil, fmt.Errorf("invalid argument %s", arguments[i])
+			}
+			filter.Count = count
+		}
+	}
+	if filter.Count == 0 && !all && len(filter.AfterID) == 0 {
+		filter.Count = defaultPullCount
+	}
+	return filter, nil
+}
+
+// pullHistory pulls the messages matching the filter from the history of the source channels of a channel
+func pullHistory(bot *discordgo.Session, destinationChannelID string, filter *pullFilter) {
+	sourceChannelIDs, err := database.GetSourceChannelIDs(destinationChannelID)
+	if err != nil {
+		log.Println("[pullHistory] Unable to get source channel IDs:", err.Error())
+		_ = sendEmbed(bot, destinationChannelID, "Failed to pull messages", "```"+err.Error()+"```")
+		return
+	}
+	var messages []*discordgo.Message
+	for _, sourceChannelID := range sourceChannelIDs {
+		sourceMessages, err := collectMessagesToPull(bot, sourceChannelID, destinationChannelID, filter)
+		if err != nil {
+			log.Printf("[pullHistory] Unable to retrieve messages in channel=%s: %s", sourceChannelID, err.Error())
+		}
+		messages = append(messages, sourceMessages...)
+	}
+	// Messages from all source channels are pulled in the order in which they were sent
+	sort.Slice(messages, func(i, j int) bool {
+		return compareSnowflakes(messages[i].ID, messages[j].ID) < 0
+	})
+	if filter.Count > 0 && len(messages) > filter.Count {
+		if len(filter.AfterID) > 0 {
+			messages = messages[:filter.Count]
+		} else {
+			messages = messages[len(messages)-filter.Count:]
+		}
+	}
+	if len(messages) == 0 {
+		_ = sendEmbed(bot, destinationChannelID, "There are no messages to pull", "")
+		return
+	}
+	progress := startPullProgress(bot, destinationChannelID, len(messages))
+	for _, messageToSend := range messages {
+		result := pullMessage(bot, messageToSend, destinationChannelID)
+		if result == pullResultPulled {
+			// The message may have been held while the channel was locked, in which case it must not be pulled again
+			_ = database.DeleteHeldMessageBySourceMessageID(messageToSend.ID, destinationChannelID)
+		}
+		progress.add(result)
+	}
+	progress.finish()
+}
+
+// collectMessagesToPull pages through the history of a source channel and returns the messages matching the filter
+// that haven't been proxied to the destination channel yet, from the most recent to the oldest
+func collectMessagesToPull(bot *discordgo.Session, sourceChannelID, destinationChannelID string, filter *pullFilter) ([]*discordgo.Message, error) {
+	var messages []*discordgo.Message
+	beforeID, afterID := "", filter.AfterID
+	for {
+		page, err := bot.ChannelMessages(sourceChannelID, 100, beforeID, afterID, "")
+		if err != nil {
+			return messages, err
+		}
+		if len(page) == 0 {
+			return messages, nil
+		}
+		// Discord returns the most recent messages first, regardless of the cursor
+		sort.Slice(page, func(i, j int) bool {
+			return compareSnowflakes(page[i].ID, page[j].ID) > 0
+		})
+		for _, m := range page {
+			if shouldPullMessage(bot, m, destinationChannelID, filter) {
+				messages = append(messages, m)
+			}
+		}
+		if len(page) < 100 {
+			return messages, nil
+		}
+		if len(afterID) > 0 {
+			afterID = page[0].ID
+		} else {
+			if filter.Count > 0 && len(messages) >= filter.Count {
+				return messages, nil
+			}
+			beforeID = page[len(page)-1].ID
+		}
+	}
+}
+
+func shouldPullMessage(bot *discordgo.Session, message *discordgo.Message, destinationChannelID string, filter *pullFilter) bool {
+	if message.Author == nil || message.Author.Bot || message.Author.ID == bot.State.User.ID || len(message.WebhookID) > 0 {
+		// Messages from bots are never proxied, which includes the copies of messages sent by the bot
+		return false
+	}
+	if strings.HasPrefix(message.Content, botCommandPrefix) {
+		return false
+	}
+	if len(filter.AuthorID) > 0 && message.Author.ID != filter.AuthorID {
+		return false
+	}
+	return !database.IsMessageProxiedToChannel(message.ID, destinationChannelID)
+}
+
+// pullHeldMessages pulls the messages that were held while a channel was locked, in the order in which they were sent.
+// If sourceChannelID isn't empty, only the messages held from that channel are pulled.
+func pullHeldMessages(bot *discordgo.Session, destinationChannelID, sourceChannelID string) {
+	heldMessages, err := database.GetHeldMessages(destinationChannelID)
+	if err != nil {
+		log.Println("[pullHeldMessages] Unable to get held messages:", err.Error())
+		_ = sendEmbed(bot, destinationChannelID, "Failed to pull messages", "```"+err.Error()+"```")
+		return
+	}
+	if len(sourceChannelID) > 0 {
+		var heldMessagesFromSourceChannel []*database.HeldMessage
+		for _, heldMessage := range heldMessages {
+			if heldMessage.SourceChannelID == sourceChannelID {
+				heldMessagesFromSourceChannel = append(heldMessagesFromSourceChannel, heldMessage)
+			}
+		}
+		heldMessages = heldMessagesFromSourceChannel
+	}
+	sourceChannelIDs, err := database.GetSourceChannelIDs(destinationChannelID)
+	if err != nil {
+		log.Println("[pullHeldMessages] Unable to get source channel IDs:", err.Error())
+		return
+	}
+	if len(heldMessages) == 0 {
+		_ = sendEmbed(bot, destinationChannelID, "There are no messages waiting to be pulled", "")
+		return
+	}
+	progress := startPullProgress(bot, destinationChannelID, len(heldMessages))
+	for _, heldMessage := range heldMessages {
+		// Only the messages that were dealt with are removed from the queue, the others are kept for the next pull
+		var dequeue bool
+		if !contains(sourceChannelIDs, heldMessage.SourceChannelID) {
+			// The channels were unbound while the message was held
+			progress.add(pullResultSkipped)
+			dequeue = true
+		} else if messageToSend, err := bot.ChannelMessage(heldMessage.SourceChannelID, heldMessage.SourceMessageID); err != nil {
+			// The message is retrieved again rather than stored, so that the changes made to it while it was held are
+			// applied, which also means that messages deleted in the meantime are skipped
+			log.Printf("[pullHeldMessages] Unable to retrieve message=%s: %s", heldMessage.SourceMessageID, err.Error())
+			if isRESTError(err, discordgo.ErrCodeUnknownMessage) || isRESTError(err, discordgo.ErrCodeUnknownChannel) {
+				progress.add(pullResultSkipped)
+				dequeue = true
+			} else {
+				progress.add(pullResultFailed)
+			}
+		} else if database.IsMessageProxiedToChannel(messageToSend.ID, destinationChannelID) {
+			progress.add(pullResultSkipped)
+			dequeue = true
+		} else {
+			result := pullMessage(bot, messageToSend, destinationChannelID)
+			progress.add(result)
+			dequeue = result != pullResultFailed
+		}
+		if !dequeue {
+			progress.kept++
+			continue
+		}
+		if err = database.DeleteHeldMessage(heldMessage.ID); err != nil {
+			log.Printf("[pullHeldMessages] Unable to remove message=%s from the queue: %s", heldMessage.SourceMessageID, err.Error())
+		}
+	}
+	progress.finish()
+}
+
+// pullMessage proxies a message to a channel, or submits it for review if the channel requires messages from the
+// source channel to be approved
+func pullMessage(bot *discordgo.Session, message *discordgo.Message, destinationChannelID string) pullResult {
+	if getBridgeMute(message, destinationChannelID) != nil {
+		return pullResultBlocked
+	}
+	// Pulling a message releases it from filter rules with the hold action, but not from those with the block action
+	if rule, _ := filterContent(message.ChannelID, destinationChannelID, message.Content); rule != nil && rule.Action == filterActionBlock {
+		if _, err := handleFilteredMessage(bot, message, destinationChannelID, rule); err != nil {
+			log.Println("[pullMessage] Unable to block message:", err.Error())
+		}
+		_ = bot.MessageReactionRemove(message.ChannelID, message.ID, "⌛", bot.State.User.ID)
+		_ = bot.MessageReactionAdd(message.ChannelID, message.ID, "❌")
+		return pullResultBlocked
+	}
+	if reviewChannelID := database.GetReviewChannelID(message.ChannelID, destinationChannelID); len(reviewChannelID) > 0 {
+		if err := submitForReview(bot, message, destinationChannelID, reviewChannelID); err != nil {
+			log.Println("[pullMessage] Unable to submit message for review:", err.Error())
+			return pullResultFailed
+		}
+		return pullResultPulled
+	}
+	if err := proxyMessage(bot, message, destinationChannelID); err == errNothingToProxy {
+		_ = bot.MessageReactionRemove(message.ChannelID, message.ID, "⌛", bot.State.User.ID)
+		return pullResultEmpty
+	} else if err != nil {
+		log.Println("[pullMessage] Unable to send message:", err.Error())
+		_ = bot.MessageReactionAdd(message.ChannelID, message.ID, "❌")
+		return pullResultFailed
+	}
+	_ = bot.MessageReactionRemove(message.ChannelID, message.ID, "⌛", bot.State.User.ID)
+	_ = bot.MessageReactionAdd(message.ChannelID, message.ID, "✅")
+	return pullResultPulled
+}
+
+func startPullProgress(bot *discordgo.Session, channelID string, total int) *pullProgress {
+	progress := &pullProgress{bot: bot, total: total}
+	progress.message, _ = bot.ChannelMessageSendEmbed(channelID, &discordgo.MessageEmbed{Title: "Pulling messages", Description: fmt.Sprintf("0/%d", total)})
+	if progress.message == nil {
+		progress.message = &discordgo.Message{ChannelID: channelID}
+	}
+	return progress
+}
+
+func (progress *pullProgress) add(result pullResult) {
+	switch result {
+	case pullResultPulled:
+		progress.pulled++
+	case pullResultSkipped, pullResultEmpty, pullResultBlocked:
+		progress.skipped++
+	default:
+		progress.failed++
+	}
+	done := progress.pulled + progress.skipped + progress.failed
+	if len(progress.message.ID) > 0 && done%pullProgressInterval == 0 && done < progress.total {
+		_, _ = progress.bot.ChannelMessageEditEmbed(progress.message.ChannelID, progress.message.ID, &discordgo.MessageEmbed{Title: "Pulling messages", Description: fmt.Sprintf("%d/%d", done, progress.total)})
+	}
+}
+
+func (progress *pullProgress) finish() {
+	summary := &discordgo.MessageEmbed{Title: "Messages pulled", Description: fmt.Sprintf("%d pulled, %d skipped because they were deleted, empty, already proxied, no longer bound, blocked or muted, %d failed", progress.pulled, progress.skipped, progress.failed)}
+	if progress.kept > 0 {
+		summary.Description += fmt.Sprintf("\n%d messages were kept in the queue, type `%spull` to try again", progress.kept, botCommandPrefix)
+	}
+	if len(progress.message.ID) > 0 {
+		_, _ = progress.bot.ChannelMessageEditEmbed(progress.message.ChannelID, progress.message.ID, summary)
+	} else {
+		_, _ = progress.bot.ChannelMessageSendEmbed(progress.message.ChannelID, summary)
+	}
+}
+
+// compareSnowflakes compares two snowflakes, which are ordered by creation date
+func compareSnowflakes(a, b string) int {
+	if len(a) != len(b) {
+		return len(a) - len(b)
+	}
+	return strings.Compare(a, b)
+}
+
+// HandleQueue shows the messages waiting to be pulled into the channel in which the command was sent, by source channel
+func HandleQueue(bot *discordgo.Session, channelID string) {
+	heldMessages, err := database.GetHeldMessages(channelID)
+	if err != nil {
+		_ = sendEmbed(bot, channelID, "Failed to retrieve queue", "```"+err.Error()+"```")
+		return
+	}
+	if len(heldMessages) == 0 {
+		_ = sendEmbed(bot, channelID, "There are no messages waiting to be pulled", "")
+		return
+	}
+	var sourceChannelIDs []string
+	heldMessagesBySourceChannelID := make(map[string][]*database.HeldMessage)
+	for _, heldMessage := range heldMessages {
+		if _, exists := heldMessagesBySourceChannelID[heldMessage.SourceChannelID]; !exists {
+			sourceChannelIDs = append(sourceChannelIDs, heldMessage.SourceChannelID)
+		}
+		heldMessagesBySourceChannelID[heldMessage.SourceChannelID] = append(heldMessagesBySourceChannelID[heldMessage.SourceChannelID], heldMessage)
+	}
+	var description string
+	for _, sourceChannelID := range sourceChannelIDs {
+		held := heldMessagesBySourceChannelID[sourceChannelID]
+		description += fmt.Sprintf("- %s: %d messages, oldest sent <t:%d:R>\n", describeChannel(bot, sourceChannelID), len(held), held[0].CreatedAt.Unix())
+	}
+	description += fmt.Sprintf("\nType `%spull` to proxy them", botCommandPrefix)
+	_ = sendEmbed(bot, channelID, fmt.Sprintf("%d messages waiting to be pulled", len(heldMessages)), description)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePullFilter(t *testing.T) {
+	scenarios := []struct {
+		name           string
+		query          string
+		expectedFilter *pullFilter
+		expectedErr    bool
+	}{
+		{
+			name:           "default",
+			query:          "",
+			expectedFilter: &pullFilter{Count: defaultPullCount},
+		},
+		{
+			name:           "count",
+			query:          "10",
+			expectedFilter: &pullFilter{Count: 10},
+		},
+		{
+			name:           "all",
+			query:          "all",
+			expectedFilter: &pullFilter{},
+		},
+		{
+			name:           "user-and-count",
+			query:          "<@!123> 5",
+			expectedFilter: &pullFilter{Count: 5, AuthorID: "123"},
+		},
+		{
+			name:           "user-only",
+			query:          "<@123>",
+			expectedFilter: &pullFilter{Count: defaultPullCount, AuthorID: "123"},
+		},
+		{
+			name:           "since-message-link",
+			query:          "since https://discord.com/channels/1/2/3",
+			expectedFilter: &pullFilter{AfterID: "3"},
+		},
+		{
+			name:           "since-message-id",
+			query:          "SINCE 456",
+			expectedFilter: &pullFilter{AfterID: "456"},
+		},
+		{
+			name:        "since-without-message",
+			query:       "since",
+			expectedErr: true,
+		},
+		{
+			name:        "since-invalid-message",
+			query:       "since yesterday",
+			expectedErr: true,
+		},
+		{
+			name:        "zero",
+			query:       "0",
+			expectedErr: true,
+		},
+		{
+			name:        "unknown-argument",
+			query:       "everything",
+			expectedErr: true,
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			filter, err := parsePullFilter(scenario.query)
+			if scenario.expectedErr {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", filter)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("expected no error, got", err.Error())
+			}
+			if !reflect.DeepEqual(filter, scenario.expectedFilter) {
+				t.Errorf("expected %+v, got %+v", scenario.expectedFilter, filter)
+			}
+		})
+	}
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TwiN/discord-channel-proxy-bot/database"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// maximumRateLimitDelay is how long a message can be delayed in channels where messages over the limit are delayed,
+	// past which the message is dropped
+	maximumRateLimitDelay = 30 * time.Second
+
+	// rateLimitStrikesBeforeMute is how many messages a user can have dropped within rateLimitStrikeWindow before being
+	// muted from the bindings of the channel for rateLimitMuteDuration
+	rateLimitStrikesBeforeMute = 5
+	rateLimitStrikeWindow      = 10 * time.Minute
+	rateLimitMuteDuration      = 10 * time.Minute
+
+	// rateLimitPruneInterval is how often the buckets and strikes that are no longer relevant are removed from memory
+	rateLimitPruneInterval = 10 * time.Minute
+
+	// rateLimitedEmoji is the reaction added to a message that was not proxied because it was over the rate limit
+	rateLimitedEmoji = "🐢"
+)
+
+// limiter keeps track of the rate at which messages are proxied through each binding
+var limiter = &rateLimiter{buckets: make(map[string]*tokenBucket), strikes: make(map[string][]time.Time), queues: make(map[string][]*delayedMessage)}
+
+// tokenBucket holds the tokens available to send messages, which are refilled continuously over the period of the rate
+// limit the bucket is for
+type tokenBucket struct {
+	tokens    float64
+	period    time.Duration
+	updatedAt time.Time
+}
+
+// bucketLimit is the limit of the bucket with the given key, which is how many messages can be sent within period
+type bucketLimit struct {
+	key      string
+	messages int
+	period   time.Duration
+}
+
+// delayedMessage is a message that is over the rate limit of a binding that delays such messages, and that is waiting
+// to be proxied through it
+type delayedMessage struct {
+	message         *discordgo.Message
+	targetChannelID string
+	sendAt          time.Time
+}
+
+type rateLimiter struct {
+	mutex   sync.Mutex
+	buckets map[string]*tokenBucket
+	strikes map[string][]time.Time
+
+	// queues are the messages waiting to be proxied through each binding, in the order in which they were sent.
+	// Each binding with a queue has a goroutine that proxies the messages of its queue until it is empty.
+	queues map[string][]*delayedMessage
+
+	prunedAt time.Time
+}
+
+// HandleRateLimit shows or configures how many messages can be proxied to the channel in which the command was sent
+// from one of its bindings, both per user and for the whole binding. Only the channel that receives the messages can
+// limit them.
+// Messages are not rate limited unless a limit was set.
+// If the channel has several bindings, the channel of the binding must be passed as first argument.
+//
+// Usage: ratelimit [CHANNEL_ID] [user MESSAGES/DURATION|off] [binding MESSAGES/DURATION|off] [drop|delay] or
+// ratelimit [CHANNEL_ID] off
+func HandleRateLimit(bot *discordgo.Session, channelID, query string) {
+	arguments := strings.Fields(strings.ToLower(query))
+	var otherChannel string
+	if len(arguments) > 0 && channelIDRegex.MatchString(arguments[0]) {
+		otherChannel = arguments[0]
+		arguments = arguments[1:]
+	}
+	otherChannelID := resolveLinkedChannelID(bot, channelID, otherChannel)
+	if len(otherChannelID) == 0 {
+		return
+	}
+	rateLimit := getRateLimit(channelID, otherChannelID)
+	if len(arguments) == 0 {
+		if rateLimit.UserMessages == 0 && rateLimit.BindingMessages == 0 {
+			_ = sendEmbed(bot, channelID, "Messages from "+describeChannel(bot, otherChannelID)+" are not rate limited", fmt.Sprintf("Type `%sratelimit user MESSAGES/DURATION` or `%sratelimit binding MESSAGES/DURATION` (e.g. `5/10s`) to set a limit", botCommandPrefix, botCommandPrefix))
+			return
+		}
+		_ = sendEmbed(bot, channelID, "Rate limit of the messages from "+describeChannel(bot, otherChannelID), describeRateLimit(rateLimit))
+		return
+	}
+	if arguments[0] == "off" || arguments[0] == "reset" {
+		if err := database.DeleteRateLimit(channelID, otherChannelID); err != nil && err != database.ErrNotFound {
+			_ = sendEmbed(bot, channelID, "Failed to remove rate limit", "```"+err.Error()+"```")
+			return
+		}
+		_ = sendEmbed(bot, channelID, "Rate limit removed", "Messages from "+describeChannel(bot, otherChannelID)+" are no longer rate limited")
+		return
+	}
+	// Several settings can be changed at once, e.g. user 5/10s delay
+	for i := 0; i < len(arguments); i++ {
+		switch arguments[i] {
+		case "drop":
+			rateLimit.Delay = false
+		case "delay":
+			rateLimit.Delay = true
+		case "user", "binding":
+			if i+1 == len(arguments) {
+				_ = sendEmbed(bot, channelID, "Missing rate limit", fmt.Sprintf("Type `%sratelimit %s MESSAGES/DURATION` (e.g. `5/10s`), or `off`", botCommandPrefix, arguments[i]))
+				return
+			}
+			var messages int
+			var period time.Duration
+			if arguments[i+1] != "off" {
+				var err error
+				if messages, period, err = parseRateLimit(arguments[i+1]); err != nil {
+					_ = sendEmbed(bot, channelID, "Invalid rate limit "+arguments[i+1], "The rate limit must be a number of messages per duration of at least one second (e.g. `5/10s` or `30/1m`)")
+					return
+				}
+			}
+			if arguments[i] == "user" {
+				rateLimit.UserMessages, rateLimit.UserPeriod = messages, period
+			} else {
+				rateLimit.BindingMessages, rateLimit.BindingPeriod = messages, period
+			}
+			i++
+		default:
+			_ = sendEmbed(bot, channelID, "Invalid arguments", fmt.Sprintf("Usage: `%sratelimit [CHANNEL_ID] [user MESSAGES/DURATION|off] [binding MESSAGES/DURATION|off] [drop|delay]`, or `%sratelimit [CHANNEL_ID] off`", botCommandPrefix, botCommandPrefix))
+			return
+		}
+	}
+	if err := database.SetRateLimit(rateLimit); err != nil {
+		_ = sendEmbed(bot, channelID, "Failed to update rate limit", "```"+err.Error()+"```")
+		return
+	}
+	_ = sendEmbed(bot, channelID, "Rate limit of the messages from "+describeChannel(bot, otherChannelID)+" updated", describeRateLimit(rateLimit))
+}
+
+// parseRateLimit parses a rate limit such as 5/10s, which is 5 messages every 10 seconds
+func parseRateLimit(value string) (int, time.Duration, error) {
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid rate limit %s", value)
+	}
+	messages, err := strconv.Atoi(parts[0])
+	if err != nil || messages < 1 {
+		return 0, 0, fmt.Errorf("invalid number of messages %s", parts[0])
+	}
+	period, err := parseDuration(parts[1])
+	if err != nil || period < time.Second {
+		return 0, 0, fmt.Errorf("invalid duration %s", parts[1])
+	}
+	return messages, period, nil
+}
+
+func describeRateLimit(rateLimit *database.RateLimit) string {
+	description := "Users: "
+	if rateLimit.UserMessages > 0 {
+		description += fmt.Sprintf("%d messages every %s\n", rateLimit.UserMessages, formatDuration(rateLimit.UserPeriod))
+	} else {
+		description += "unlimited\n"
+	}
+	description += "Binding: "
+	if rateLimit.BindingMessages > 0 {
+		description += fmt.Sprintf("%d messages every %s\n", rateLimit.BindingMessages, formatDuration(rateLimit.BindingPeriod))
+	} else {
+		description += "unlimited\n"
+	}
+	if rateLimit.UserMessages == 0 && rateLimit.BindingMessages == 0 {
+		return description
+	}
+	if rateLimit.Delay {
+		description += "Messages over the limit are delayed by up to " + formatDuration(maximumRateLimitDelay) + ", and dropped past that"
+	} else {
+		description += "Messages over the limit are dropped"
+	}
+	return description + fmt.Sprintf("\nUsers who have %d messages dropped by the user limit within %s are muted from the binding for %s", rateLimitStrikesBeforeMute, formatDuration(rateLimitStrikeWindow), formatDuration(rateLimitMuteDuration))
+}
+
+// getRateLimit returns the rate limit set by a channel on the messages proxied to it from the other channel, or a rate
+// limit that doesn't limit anything if the channel has set none
+func getRateLimit(channelID, otherChannelID string) *database.RateLimit {
+	rateLimit, err := database.GetRateLimit(channelID, otherChannelID)
+	if err != nil {
+		if err != database.ErrNotFound {
+			log.Printf("[getRateLimit] Failed to get rate limit of channel=%s for channel=%s: %s", channelID, otherChannelID, err.Error())
+		}
+		return &database.RateLimit{ChannelID: channelID, OtherChannelID: otherChannelID}
+	}
+	return rateLimit
+}
+
+// getRateLimitBucketKeys returns the keys of the buckets of the binding through which messages are proxied from the
+// source channel to the target channel, and of the bucket of the user within that binding
+func getRateLimitBucketKeys(sourceChannelID, targetChannelID, userID string) (bindingKey, userKey string) {
+	bindingKey = sourceChannelID + ">" + targetChannelID
+	return bindingKey, bindingKey + ":" + userID
+}
+
+// takeRateLimitTokens takes a token from the bucket of the author of a message and from the bucket of the binding
+// through which the message is proxied to the target channel, and returns how long the message must be delayed, as well
+// as whether the message can be proxied at all. Messages can only be delayed if the rate limit of the binding delays the
+// messages over the limit, and by up to maximumRateLimitDelay.
+// No token is taken from either bucket unless both have one, so that a message dropped by the limit of the binding
+// doesn't count against the limit of its author, and vice versa.
+func takeRateLimitTokens(bot *discordgo.Session, message *discordgo.Message, targetChannelID string, rateLimit *database.RateLimit) (time.Duration, bool) {
+	var maximumWait time.Duration
+	if rateLimit.Delay {
+		maximumWait = maximumRateLimitDelay
+	}
+	bindingKey, userKey := getRateLimitBucketKeys(message.ChannelID, targetChannelID, message.Author.ID)
+	wait, exceeded := limiter.take([]bucketLimit{
+		{key: userKey, messages: rateLimit.UserMessages, period: rateLimit.UserPeriod},
+		{key: bindingKey, messages: rateLimit.BindingMessages, period: rateLimit.BindingPeriod},
+	}, maximumWait, time.Now())
+	if exceeded == nil {
+		return wait, true
+	}
+	if exceeded.key == userKey {
+		log.Printf("[takeRateLimitTokens] Dropping message=%s from channel=%s to channel=%s because user=%s is over the limit", message.ID, message.ChannelID, targetChannelID, message.Author.ID)
+		strikeRateLimitedUser(bot, message, targetChannelID, rateLimit)
+	} else {
+		log.Printf("[takeRateLimitTokens] Dropping message=%s from channel=%s to channel=%s because the binding is over the limit", message.ID, message.ChannelID, targetChannelID)
+	}
+	return 0, false
+}
+
+// delayMessage queues a message to be proxied to the target channel once it's no longer over the rate limit of the
+// binding, and returns whether it was queued. A message that doesn't have to wait is still queued if other messages
+// are already waiting to be proxied through the binding, so that messages are proxied in the order in which they were
+// sent.
+func delayMessage(bot *discordgo.Session, message *discordgo.Message, targetChannelID string, wait time.Duration) bool {
+	bindingKey, _ := getRateLimitBucketKeys(message.ChannelID, targetChannelID, message.Author.ID)
+	queued, first := limiter.enqueue(bindingKey, &delayedMessage{message: message, targetChannelID: targetChannelID, sendAt: time.Now().Add(wait)}, wait > 0)
+	if !queued {
+		return false
+	}
+	log.Printf("[delayMessage] Delaying message=%s from channel=%s to channel=%s by %s", message.ID, message.ChannelID, targetChannelID, wait)
+	if first {
+		go relayDelayedMessages(bot, bindingKey)
+	}
+	return true
+}
+
+// relayDelayedMessages proxies the messages waiting to be proxied through a binding one after the other, until there
+// are none left
+func relayDelayedMessages(bot *discordgo.Session, bindingKey string) {
+	for delayed := limiter.front(bindingKey); delayed != nil; delayed = limiter.next(bindingKey) {
+		time.Sleep(time.Until(delayed.sendAt))
+		_ = bot.MessageReactionRemove(delayed.message.ChannelID, delayed.message.ID, "⌛", bot.State.User.ID)
+		// The message is retrieved again, so that the changes made to it while it was delayed are applied, which also
+		// means that messages deleted in the meantime are skipped
+		message, err := bot.ChannelMessage(delayed.message.ChannelID, delayed.message.ID)
+		if err != nil {
+			log.Printf("[relayDelayedMessages] Unable to retrieve message=%s: %s", delayed.message.ID, err.Error())
+			continue
+		}
+		if getBridgeMute(message, delayed.targetChannelID) != nil {
+			_ = bot.MessageReactionAdd(message.ChannelID, message.ID, mutedEmoji)
+			continue
+		}
+		switch relayMessage(bot, message, delayed.targetChannelID) {
+		case relayResultProxied:
+			_ = bot.MessageReactionAdd(message.ChannelID, message.ID, "✅")
+		case relayResultPending:
+			_ = bot.MessageReactionAdd(message.ChannelID, message.ID, "⌛")
+		case relayResultBlocked, relayResultFailed:
+			_ = bot.MessageReactionAdd(message.ChannelID, message.ID, "❌")
+		}
+	}
+}
+
+// strikeRateLimitedUser lets the author of a message that was dropped because they were over the rate limit of a
+// binding know, and mutes them from that binding if they have had too many messages dropped recently.
+// Only messages dropped because their author was over the limit count against them, since a binding being over its limit
+// can be caused by the messages of other users.
+func strikeRateLimitedUser(bot *discordgo.Session, message *discordgo.Message, targetChannelID string, rateLimit *database.RateLimit) {
+	_, key := getRateLimitBucketKeys(message.ChannelID, targetChannelID, message.Author.ID)
+	strikes := limiter.strike(key, time.Now())
+	if strikes == 1 {
+		_ = sendEmbed(bot, message.ChannelID, "Slow down", "<@"+message.Author.ID+">, some of your messages were not proxied to "+describeChannel(bot, targetChannelID)+" because they were sent too fast.\n"+describeRateLimit(rateLimit))
+	}
+	if strikes < rateLimitStrikesBeforeMute {
+		return
+	}
+	limiter.resetStrikes(key)
+	if getBridgeMute(message, targetChannelID) != nil {
+		// The user must not be unbanned, or have a longer mute shortened, by the automatic mute
+		return
+	}
+	now := time.Now()
+	// The mute belongs to the channel that set the rate limit, so that only that channel can lift it
+	err := database.SetBridgeMute(&database.BridgeMute{
+		ChannelID:      targetChannelID,
+		OtherChannelID: message.ChannelID,
+		UserID:         message.Author.ID,
+		ExpiresAt:      now.Add(rateLimitMuteDuration),
+		CreatedAt:      now,
+	})
+	if err != nil {
+		log.Printf("[strikeRateLimitedUser] Failed to mute user=%s from channel=%s to channel=%s: %s", message.Author.ID, message.ChannelID, targetChannelID, err.Error())
+		return
+	}
+	log.Printf("[strikeRateLimitedUser] Muted user=%s from the binding between channel=%s and channel=%s for flooding", message.Author.ID, message.ChannelID, targetChannelID)
+	_ = sendEmbed(bot, message.ChannelID, "User muted", fmt.Sprintf("<@%s> is muted from the binding with %s for %s for sending too many messages too fast", message.Author.ID, describeChannel(bot, targetChannelID), formatDuration(rateLimitMuteDuration)))
+}
+
+// take takes a token from each of the buckets of the limits passed as parameter, which are created full if they don't
+// exist yet, and returns how long to wait before using the tokens.
+// If a bucket is empty, the tokens are only taken if the next token of that bucket is available within maximumWait.
+// Otherwise, no token is taken from any of the buckets, and the first limit that would have to wait longer is returned.
+// Limits with no messages are treated as unlimited.
+func (limiter *rateLimiter) take(limits []bucketLimit, maximumWait time.Duration, now time.Time) (time.Duration, *bucketLimit) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	limiter.prune(now)
+	var wait time.Duration
+	var buckets []*tokenBucket
+	for i, limit := range limits {
+		if limit.messages <= 0 || limit.period <= 0 {
+			continue
+		}
+		bucket, exists := limiter.buckets[limit.key]
+		if !exists {
+			bucket = &tokenBucket{tokens: float64(limit.messages), updatedAt: now}
+			limiter.buckets[limit.key] = bucket
+		}
+		tokensPerSecond := float64(limit.messages) / limit.period.Seconds()
+		bucket.tokens += now.Sub(bucket.updatedAt).Seconds() * tokensPerSecond
+		if bucket.tokens > float64(limit.messages) {
+			bucket.tokens = float64(limit.messages)
+		}
+		bucket.period, bucket.updatedAt = limit.period, now
+		if bucket.tokens < 1 {
+			bucketWait := time.Duration((1 - bucket.tokens) / tokensPerSecond * float64(time.Second))
+			if bucketWait > maximumWait {
+				return bucketWait, &limits[i]
+			}
+			if bucketWait > wait {
+				wait = bucketWait
+			}
+		}
+		buckets = append(buckets, bucket)
+	}
+	// The tokens are taken even if they aren't available yet, so that the messages that are delayed are sent one after
+	// the other rather than all at once
+	for _, bucket := range buckets {
+		bucket.tokens--
+	}
+	return wait, nil
+}
+
+// enqueue adds a message to the queue of a binding if it must be delayed or if the queue isn't empty, and returns
+// whether it was added, as well as whether it's the first message of the queue, in which case the queue must be
+// processed by a new goroutine
+func (limiter *rateLimiter) enqueue(key string, delayed *delayedMessage, mustWait bool) (queued, first bool) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	queue := limiter.queues[key]
+	if !mustWait && len(queue) == 0 {
+		return false, false
+	}
+	limiter.queues[key] = append(queue, delayed)
+	return true, len(queue) == 0
+}
+
+// front returns the first message of the queue of a binding, or nil if the queue is empty
+func (limiter *rateLimiter) front(key string) *delayedMessage {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	if queue := limiter.queues[key]; len(queue) > 0 {
+		return queue[0]
+	}
+	return nil
+}
+
+// next removes the first message of the queue of a binding and returns the message that follows it, or deletes the
+// queue and returns nil if there is none, both of which are done at once so that a message added to the queue after
+// it was deleted is processed by a new goroutine
+func (limiter *rateLimiter) next(key string) *delayedMessage {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	queue := limiter.queues[key]
+	if len(queue) <= 1 {
+		delete(limiter.queues, key)
+		return nil
+	}
+	limiter.queues[key] = queue[1:]
+	return queue[1]
+}
+
+// strike records that a message of a user was dropped, and returns how many of their messages were dropped within
+// rateLimitStrikeWindow
+func (limiter *rateLimiter) strike(key string, now time.Time) int {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	var strikes []time.Time
+	for _, strike := range limiter.strikes[key] {
+		if now.Sub(strike) < rateLimitStrikeWindow {
+			strikes = append(strikes, strike)
+		}
+	}
+	limiter.strikes[key] = append(strikes, now)
+	return len(limiter.strikes[key])
+}
+
+func (limiter *rateLimiter) resetStrikes(key string) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	delete(limiter.strikes, key)
+}
+
+// prune removes the buckets that have been refilled entirely and the strikes that are no longer within the window,
+// since keeping them makes no difference. It must be called while holding the lock of the limiter.
+func (limiter *rateLimiter) prune(now time.Time) {
+	if now.Sub(limiter.prunedAt) < rateLimitPruneInterval {
+		return
+	}
+	limiter.prunedAt = now
+	for key, bucket := range limiter.buckets {
+		// Delayed messages can take tokens in advance, so a bucket may take up to maximumRateLimitDelay longer to refill
+		if now.Sub(bucket.updatedAt) > bucket.period+maximumRateLimitDelay {
+			delete(limiter.buckets, key)
+		}
+	}
+	for key, strikes := range limiter.strikes {
+		if now.Sub(strikes[len(strikes)-1]) >= rateLimitStrikeWindow {
+			delete(limiter.strikes, key)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	scenarios := []struct {
+		value            string
+		expectedMessages int
+		expectedPeriod   time.Duration
+		expectedErr      bool
+	}{
+		{value: "5/10s", expectedMessages: 5, expectedPeriod: 10 * time.Second},
+		{value: "30/1m", expectedMessages: 30, expectedPeriod: time.Minute},
+		{value: "100/1d", expectedMessages: 100, expectedPeriod: 24 * time.Hour},
+		{value: "1/1s", expectedMessages: 1, expectedPeriod: time.Second},
+		{value: "5", expectedErr: true},
+		{value: "0/10s", expectedErr: true},
+		{value: "-1/10s", expectedErr: true},
+		{value: "five/10s", expectedErr: true},
+		{value: "5/500ms", expectedErr: true},
+		{value: "5/soon", expectedErr: true},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.value, func(t *testing.T) {
+			messages, period, err := parseRateLimit(scenario.value)
+			if scenario.expectedErr {
+				if err == nil {
+					t.Errorf("expected an error, got %d/%s", messages, period)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("expected no error, got", err.Error())
+			}
+			if messages != scenario.expectedMessages || period != scenario.expectedPeriod {
+				t.Errorf("expected %d/%s, got %d/%s", scenario.expectedMessages, scenario.expectedPeriod, messages, period)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_take(t *testing.T) {
+	type attempt struct {
+		// after is how long after the first attempt the attempt is made
+		after       time.Duration
+		maximumWait time.Duration
+
+		expectedWait time.Duration
+		// expectedExceededKey is the key of the limit that is exceeded, or an empty string if the tokens must be taken
+		expectedExceededKey string
+	}
+	scenarios := []struct {
+		name     string
+		limits   []bucketLimit
+		attempts []attempt
+		// expectedTokens is the number of tokens left in each bucket after the last attempt
+		expectedTokens map[string]float64
+	}{
+		{
+			name:     "unlimited",
+			limits:   []bucketLimit{{key: "user"}, {key: "binding"}},
+			attempts: []attempt{{}, {}, {}},
+		},
+		{
+			name:   "drop-over-limit",
+			limits: []bucketLimit{{key: "user", messages: 2, period: 10 * time.Second}},
+			attempts: []attempt{
+				{},
+				{},
+				{expectedWait: 5 * time.Second, expectedExceededKey: "user"},
+			},
+			expectedTokens: map[string]float64{"user": 0},
+		},
+		{
+			name:   "refill",
+			limits: []bucketLimit{{key: "user", messages: 2, period: 10 * time.Second}},
+			attempts: []attempt{
+				{},
+				{},
+				{after: 5 * time.Second},
+				{after: 5 * time.Second, expectedWait: 5 * time.Second, expectedExceededKey: "user"},
+			},
+			expectedTokens: map[string]float64{"user": 0},
+		},
+		{
+			name:   "delay-over-limit",
+			limits: []bucketLimit{{key: "user", messages: 2, period: 10 * time.Second}},
+			attempts: []attempt{
+				{maximumWait: 30 * time.Second},
+				{maximumWait: 30 * time.Second},
+				{maximumWait: 30 * time.Second, expectedWait: 5 * time.Second},
+				{maximumWait: 30 * time.Second, expectedWait: 10 * time.Second},
+				{maximumWait: 12 * time.Second, expectedWait: 15 * time.Second, expectedExceededKey: "user"},
+			},
+			expectedTokens: map[string]float64{"user": -2},
+		},
+		{
+			name: "longest-wait",
+			limits: []bucketLimit{
+				{key: "user", messages: 1, period: 10 * time.Second},
+				{key: "binding", messages: 1, period: 20 * time.Second},
+			},
+			attempts: []attempt{
+				{maximumWait: 30 * time.Second},
+				{maximumWait: 30 * time.Second, expectedWait: 20 * time.Second},
+			},
+			expectedTokens: map[string]float64{"user": -1, "binding": -1},
+		},
+		{
+			name: "user-over-limit-does-not-take-from-binding",
+			limits: []bucketLimit{
+				{key: "user", messages: 1, period: 10 * time.Second},
+				{key: "binding", messages: 5, period: 10 * time.Second},
+			},
+			attempts: []attempt{
+				{},
+				{expectedWait: 10 * time.Second, expectedExceededKey: "user"},
+			},
+			expectedTokens: map[string]float64{"user": 0, "binding": 4},
+		},
+		{
+			name: "binding-over-limit-does-not-take-from-user",
+			limits: []bucketLimit{
+				{key: "user", messages: 5, period: 10 * time.Second},
+				{key: "binding", messages: 1, period: 10 * time.Second},
+			},
+			attempts: []attempt{
+				{},
+				{expectedWait: 10 * time.Second, expectedExceededKey: "binding"},
+			},
+			expectedTokens: map[string]float64{"user": 4, "binding": 0},
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			limiter := &rateLimiter{buckets: make(map[string]*tokenBucket), strikes: make(map[string][]time.Time), queues: make(map[string][]*delayedMessage)}
+			start := time.Now()
+			for i, attempt := range scenario.attempts {
+				wait, exceeded := limiter.take(scenario.limits, attempt.maximumWait, start.Add(attempt.after))
+				var exceededKey string
+				if exceeded != nil {
+					exceededKey = exceeded.key
+				}
+				if exceededKey != attempt.expectedExceededKey {
+					t.Errorf("attempt #%d: expected the exceeded limit to be %q, got %q", i, attempt.expectedExceededKey, exceededKey)
+				}
+				if wait != attempt.expectedWait {
+					t.Errorf("attempt #%d: expected a wait of %s, got %s", i, attempt.expectedWait, wait)
+				}
+			}
+			for key, expectedTokens := range scenario.expectedTokens {
+				if tokens := limiter.buckets[key].tokens; tokens != expectedTokens {
+					t.Errorf("expected bucket %s to have %v tokens, got %v", key, expectedTokens, tokens)
+				}
+			}
+		})
+	}
+}
+
+func TestGetRateLimitBucketKeys(t *testing.T) {
+	bindingKey, userKey := getRateLimitBucketKeys("1", "2", "3")
+	if bindingKey != "1>2" || userKey != "1>2:3" {
+		t.Errorf("expected 1>2 and 1>2:3, got %s and %s", bindingKey, userKey)
+	}
+	// Each direction of a binding has its own limit
+	if otherBindingKey, _ := getRateLimitBucketKeys("2", "1", "3"); otherBindingKey == bindingKey {
+		t.Error("expected each direction of a binding to have its own bucket")
+	}
+}
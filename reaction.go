@@ -0,0 +1,105 @@
+package main
+
+import (
+	"log"
+
+	"github.com/TwiN/discord-channel-proxy-bot/database"
+	"github.com/bwmarrin/discordgo"
+)
+
+// HandleMessageReactionAdd mirrors a reaction added to a message on all of the message's counterparts
+func HandleMessageReactionAdd(bot *discordgo.Session, reaction *discordgo.MessageReactionAdd) {
+	if reaction.UserID != bot.State.User.ID && handleReviewReaction(bot, reaction.MessageReaction) {
+		return
+	}
+	if !shouldMirrorReaction(bot, reaction.MessageReaction) {
+		return
+	}
+	for _, counterpart := range getMirrorableCounterpartMessages(reaction.MessageReaction) {
+		if mute, _ := database.GetBridgeMute(reaction.ChannelID, counterpart.ChannelID, reaction.UserID); mute != nil {
+			// Users muted from a binding can't react through it either
+			continue
+		}
+		if err := bot.MessageReactionAdd(counterpart.ChannelID, counterpart.ID, reaction.Emoji.APIName()); err != nil {
+			log.Printf("[HandleMessageReactionAdd] Failed to mirror reaction on message=%s in channel=%s: %s", counterpart.ID, counterpart.ChannelID, err.Error())
+		}
+	}
+}
+
+// HandleMessageReactionRemove removes a mirrored reaction from all of the message's counterparts once nobody is
+// reacting with that emoji on the message anymore
+func HandleMessageReactionRemove(bot *discordgo.Session, reaction *discordgo.MessageReactionRemove) {
+	if !shouldMirrorReaction(bot, reaction.MessageReaction) {
+		return
+	}
+	users, err := bot.MessageReactions(reaction.ChannelID, reaction.MessageID, reaction.Emoji.APIName(), 100, "", "")
+	if err != nil {
+		log.Println("[HandleMessageReactionRemove] Failed to get users who reacted to message:", err.Error())
+		return
+	}
+	for _, user := range users {
+		if user.ID != bot.State.User.ID {
+			// Someone else is still reacting with that emoji, so the mirrored reactions must stay
+			return
+		}
+	}
+	for _, counterpart := range getMirrorableCounterpartMessages(reaction.MessageReaction) {
+		if err := bot.MessageReactionRemove(counterpart.ChannelID, counterpart.ID, reaction.Emoji.APIName(), bot.State.User.ID); err != nil {
+			log.Printf("[HandleMessageReactionRemove] Failed to remove mirrored reaction on message=%s in channel=%s: %s", counterpart.ID, counterpart.ChannelID, err.Error())
+		}
+	}
+}
+
+func shouldMirrorReaction(bot *discordgo.Session, reaction *discordgo.MessageReaction) bool {
+	// Reactions added by the bot are either status reactions or mirrored reactions, neither of which must be mirrored
+	return reaction.UserID != bot.State.User.ID
+}
+
+// getMirrorableCounterpartMessages returns the counterparts of the message a reaction was added to or removed from,
+// excluding those in channels that messages from the reaction's channel are not proxied to (e.g. a subscriber's
+// reactions are not mirrored to the publisher)
+func getMirrorableCounterpartMessages(reaction *discordgo.MessageReaction) []*discordgo.Message {
+	targetChannelIDs, err := database.GetTargetChannelIDs(reaction.ChannelID)
+	if err != nil {
+		log.Println("[getMirrorableCounterpartMessages] Failed to get target channel IDs:", err.Error())
+		return nil
+	}
+	var counterparts []*discordgo.Message
+	for _, counterpart := range getCounterpartMessages(reaction.MessageID) {
+		for _, targetChannelID := range targetChannelIDs {
+			if counterpart.ChannelID == targetChannelID {
+				counterparts = append(counterparts, counterpart)
+				break
+			}
+		}
+	}
+	return counterparts
+}
+
+// getCounterpartMessages returns the messages that are copies of the message passed as parameter, as well as the
+// message it is a copy of, if applicable.
+// For copies that have been split into several messages, only the first part is returned.
+//
+// Note that the returned messages only have their ID and ChannelID set.
+func getCounterpartMessages(messageID string) []*discordgo.Message {
+	var counterparts []*discordgo.Message
+	sourceMessageID := messageID
+	if proxiedMessage, err := database.GetProxiedMessageByProxyMessageID(messageID); err == nil {
+		sourceMessageID = proxiedMessage.SourceMessageID
+		counterparts = append(counterparts, &discordgo.Message{ID: proxiedMessage.SourceMessageID, ChannelID: proxiedMessage.SourceChannelID})
+	} else if err != database.ErrNotFound {
+		log.Println("[getCounterpartMessages] Failed to get proxied message:", err.Error())
+		return nil
+	}
+	proxiedMessages, err := database.GetProxiedMessagesBySourceMessageID(sourceMessageID)
+	if err != nil {
+		log.Println("[getCounterpartMessages] Failed to get proxied messages:", err.Error())
+		return nil
+	}
+	for _, proxiedMessage := range proxiedMessages {
+		if proxiedMessage.ProxyMessageID != messageID && proxiedMessage.Part == 0 {
+			counterparts = append(counterparts, &discordgo.Message{ID: proxiedMessage.ProxyMessageID, ChannelID: proxiedMessage.ProxyChannelID})
+		}
+	}
+	return counterparts
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maximumReplyQuoteLength is the maximum number of characters of the original message included in a reply's quote
+const maximumReplyQuoteLength = 100
+
+// getReplyReference returns a reference to the counterpart, in the target channel, of the message being replied to,
+// or nil if the message being replied to has no counterpart in the target channel
+func getReplyReference(reference *discordgo.MessageReference, targetChannelID string) *discordgo.MessageReference {
+	for _, counterpart := range getCounterpartMessages(reference.MessageID) {
+		if counterpart.ChannelID == targetChannelID {
+			return &discordgo.MessageReference{MessageID: counterpart.ID, ChannelID: counterpart.ChannelID}
+		}
+	}
+	return nil
+}
+
+// buildReplyQuote returns a quoted excerpt of the message being replied to, which is used in place of a reply when
+// the message being replied to has no counterpart in the target channel.
+// The excerpt goes through the filter rules of the binding, and no excerpt is returned if the message being replied to
+// must not be proxied to the target channel, such as when it was blocked or its author is muted.
+func buildReplyQuote(bot *discordgo.Session, reference *discordgo.MessageReference, targetChannelID string) string {
+	repliedMessage, err := bot.ChannelMessage(reference.ChannelID, reference.MessageID)
+	if err != nil {
+		log.Printf("[buildReplyQuote] Failed to retrieve message=%s being replied to: %s", reference.MessageID, err.Error())
+		return ""
+	}
+	if getBridgeMute(repliedMessage, targetChannelID) != nil {
+		return ""
+	}
+	rule, content := filterContent(repliedMessage.ChannelID, targetChannelID, repliedMessage.Content)
+	if rule != nil {
+		return ""
+	}
+	excerpt := strings.Join(strings.Fields(content), " ")
+	if runes := []rune(excerpt); len(runes) > maximumReplyQuoteLength {
+		excerpt = string(runes[:maximumReplyQuoteLength]) + "…"
+	}
+	if len(excerpt) == 0 {
+		excerpt = "*attachment*"
+	}
+	return "> **" + getAuthorDisplayName(repliedMessage) + "**: " + excerpt + "\n"
+}
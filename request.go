@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/TwiN/discord-channel-proxy-bot/database"
+	"github.com/bwmarrin/discordgo"
+)
+
+const defaultBindRequestExpiry = 24 * time.Hour
+
+// bindRequestExpiry is how long a channel has to answer a request before it expires.
+// It can be configured through the BIND_REQUEST_EXPIRY environment variable (e.g. 30m, 12h).
+var bindRequestExpiry = defaultBindRequestExpiry
+
+// sendBindRequest sends a request from a channel to another channel and stores it until it's answered or expires
+func sendBindRequest(bot *discordgo.Session, request *database.BindRequest) error {
+	title, replyCommand := describeBindRequest(request)
+	description := fmt.Sprintf("Click Accept or reply `%s%s %s` to accept this request, which expires <t:%d:R>", botCommandPrefix, replyCommand, request.FromChannelID, request.ExpiresAt.Unix())
+	acceptButton := &button{Type: componentTypeButton, Style: buttonStyleSuccess, Label: "Accept", CustomID: acceptRequestButtonPrefix + request.Type + ":" + request.FromChannelID}
+	declineButton := &button{Type: componentTypeButton, Style: buttonStyleDanger, Label: "Decline", CustomID: declineRequestButtonPrefix + request.FromChannelID}
+	if err := sendEmbedWithButtons(bot, request.ToChannelID, title, description, acceptButton, declineButton); err != nil {
+		return err
+	}
+	return database.CreateBindRequest(request)
+}
+
+// newBindRequest creates a request of the type passed as parameter that expires after bindRequestExpiry
+func newBindRequest(requestType, fromChannelID, toChannelID string) *database.BindRequest {
+	now := time.Now()
+	return &database.BindRequest{
+		Type:          requestType,
+		FromChannelID: fromChannelID,
+		ToChannelID:   toChannelID,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(bindRequestExpiry),
+	}
+}
+
+// describeBindRequest returns the title of the message notifying a channel of a request, as well as the command that
+// the channel must reply with to accept it
+func describeBindRequest(request *database.BindRequest) (title, replyCommand string) {
+	switch request.Type {
+	case database.RequestTypePublish:
+		return "Subscription request from " + request.FromChannelID, "subscribe"
+	case database.RequestTypeSubscribe:
+		return "Publication request from " + request.FromChannelID, "publish"
+	case database.RequestTypeHubJoin:
+		return "Request from " + request.FromChannelID + " to join the hub", "hub accept"
+	case database.RequestTypeHubInvite:
+		return "Invitation from " + request.FromChannelID + " to replace your binding with it by its hub", "hub accept"
+	default:
+		return "Binding request from " + request.FromChannelID, "bind"
+	}
+}
+
+// HandleRequests lists the outstanding requests sent from or to the channel in which the command was sent
+func HandleRequests(bot *discordgo.Session, channelID string) {
+	requests, err := database.GetBindRequestsByChannelID(channelID)
+	if err != nil {
+		_ = sendEmbed(bot, channelID, "Failed to retrieve requests", "```"+err.Error()+"```")
+		return
+	}
+	var outgoing, incoming string
+	for _, request := range requests {
+		if request.ExpiresAt.Before(time.Now()) {
+			continue
+		}
+		if request.FromChannelID == channelID {
+			outgoing += fmt.Sprintf("- `%s` to %s, expires <t:%d:R>\n", request.Type, describeChannel(bot, request.ToChannelID), request.ExpiresAt.Unix())
+		} else {
+			incoming += fmt.Sprintf("- `%s` from %s, expires <t:%d:R>\n", request.Type, describeChannel(bot, request.FromChannelID), request.ExpiresAt.Unix())
+		}
+	}
+	var fields []*discordgo.MessageEmbedField
+	if len(outgoing) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Sent", Value: outgoing})
+	}
+	if len(incoming) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Received", Value: incoming})
+	}
+	embed := &discordgo.MessageEmbed{Title: "Pending requests", Fields: fields}
+	if len(fields) == 0 {
+		embed.Description = "There are no pending requests for this channel"
+	}
+	if _, err = bot.ChannelMessageSendEmbed(channelID, embed); err != nil {
+		log.Println("[HandleRequests] Failed to send requests:", err.Error())
+	}
+}
+
+// HandleCancelRequest cancels the pending requests between the channel in which the command was sent and another
+// channel, regardless of which of the two channels sent them. This can be used to decline a request as well.
+func HandleCancelRequest(bot *discordgo.Session, channelID, otherChannel string) {
+	otherChannelID := parseChannelID(otherChannel)
+	requests, err := database.DeleteBindRequestsBetweenChannels(channelID, otherChannelID)
+	if err != nil {
+		_ = sendEmbed(bot, channelID, "Failed to cancel requests", "```"+err.Error()+"```")
+		return
+	}
+	if len(requests) == 0 {
+		_ = sendEmbed(bot, channelID, "There are no pending requests with "+otherChannelID, "")
+		return
+	}
+	_ = sendEmbed(bot, channelID, "Requests with "+otherChannelID+" cancelled", "")
+	_ = sendEmbed(bot, otherChannelID, "Requests with "+channelID+" cancelled", "")
+}
+
+// HandleResendRequest sends the pending requests from the channel in which the command was sent to another channel
+// again, and resets their expiration
+func HandleResendRequest(bot *discordgo.Session, channelID, otherChannel string) {
+	otherChannelID := parseChannelID(otherChannel)
+	requests, err := database.GetBindRequestsByChannelID(channelID)
+	if err != nil {
+		_ = sendEmbed(bot, channelID, "Failed to retrieve requests", "```"+err.Error()+"```")
+		return
+	}
+	var resent int
+	for _, request := range requests {
+		if request.FromChannelID != channelID || request.ToChannelID != otherChannelID {
+			continue
+		}
+		if err = sendBindRequest(bot, newBindRequest(request.Type, request.FromChannelID, request.ToChannelID)); err != nil {
+			_ = sendEmbed(bot, channelID, "Failed to send request", "```"+err.Error()+"```")
+			return
+		}
+		resent++
+	}
+	if resent == 0 {
+		_ = sendEmbed(bot, channelID, "There are no pending requests to "+otherChannelID, "")
+		return
+	}
+	_ = sendEmbed(bot, channelID, "Request sent again", "")
+}
+
+// expireBindRequests periodically deletes the requests that have expired, and notifies the channels that sent them
+func expireBindRequests(bot *discordgo.Session) {
+	for range time.Tick(time.Minute) {
+		requests, err := database.DeleteExpiredBindRequests(time.Now())
+		if err != nil {
+			log.Println("[expireBindRequests] Failed to delete expired requests:", err.Error())
+			continue
+		}
+		// A request to join a hub is sent to every member of the hub, but the channel that sent it must only be notified
+		// once
+		notifiedHubJoinRequests := make(map[string]bool)
+		for _, request := range requests {
+			log.Printf("[expireBindRequests] Request type=%s from=%s to=%s expired", request.Type, request.FromChannelID, request.ToChannelID)
+			if request.Type != database.RequestTypeHubJoin {
+				_ = sendEmbed(bot, request.FromChannelID, "Request to "+request.ToChannelID+" expired", fmt.Sprintf("Type `%sresend %s` to send it again", botCommandPrefix, request.ToChannelID))
+				continue
+			}
+			if notifiedHubJoinRequests[request.FromChannelID] {
+				continue
+			}
+			notifiedHubJoinRequests[request.FromChannelID] = true
+			if hubName, err := database.GetHubNameByChannelID(request.ToChannelID); err == nil {
+				_ = sendEmbed(bot, request.FromChannelID, "Request to join hub "+hubName+" expired", fmt.Sprintf("Type `%shub join %s` to send it again", botCommandPrefix, hubName))
+			} else {
+				_ = sendEmbed(bot, request.FromChannelID, "Request to join the hub expired", "")
+			}
+		}
+	}
+}
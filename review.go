@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/TwiN/discord-channel-proxy-bot/database"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	approveReviewButtonID  = "approve"
+	rejectReviewButtonID   = "reject"
+	rejectionReasonInputID = "reason"
+
+	// rejectionEmoji is the reaction added to a message that was rejected by the moderators of the channel it was going
+	// to be proxied to
+	rejectionEmoji = "🚫"
+
+	// maximumEmbedDescriptionLength is the maximum length Discord allows for the description of an embed
+	maximumEmbedDescriptionLength = 4096
+)
+
+// HandleApproval shows or configures the approval mode of the bindings of the channel in which the command was sent.
+// In approval mode, messages from the other channel are posted in a review channel instead, and only proxied once a
+// moderator approves them.
+//
+// Usage: approval [REVIEW_CHANNEL_ID|off] [CHANNEL_ID]
+func HandleApproval(bot *discordgo.Session, message *discordgo.Message, query string) {
+	arguments := strings.Fields(query)
+	if len(arguments) == 0 {
+		connectedChannelIDs, _ := database.GetConnectedChannelIDs(message.ChannelID)
+		var description string
+		for _, connectedChannelID := range connectedChannelIDs {
+			description += "- " + describeChannel(bot, connectedChannelID) + ": " + describeApproval(database.GetReviewChannelID(connectedChannelID, message.ChannelID)) + "\n"
+		}
+		if len(description) == 0 {
+			description = "This channel is not bound to any channel"
+		}
+		_ = sendEmbed(bot, message.ChannelID, "Approval mode", description)
+		return
+	}
+	var otherChannel string
+	if len(arguments) > 1 {
+		otherChannel = arguments[1]
+	}
+	otherChannelID := resolveConnectedChannelID(bot, message.ChannelID, otherChannel)
+	if len(otherChannelID) == 0 {
+		return
+	}
+	var reviewChannelID string
+	if strings.ToLower(arguments[0]) != "off" {
+		reviewChannelID = parseChannelID(arguments[0])
+		reviewChannel, err := getChannel(bot, reviewChannelID)
+		if err != nil || reviewChannel.GuildID != message.GuildID {
+			_ = sendEmbed(bot, message.ChannelID, "Invalid review channel "+arguments[0], "The review channel must be a channel of this server that the bot has access to")
+			return
+		}
+	}
+	if err := database.SetReviewChannelID(message.ChannelID, otherChannelID, reviewChannelID); err != nil {
+		if err == database.ErrNotFound {
+			_ = sendEmbed(bot, message.ChannelID, "Channel is not bound to "+otherChannelID, "")
+		} else {
+			_ = sendEmbed(bot, message.ChannelID, "Failed to configure approval mode", "```"+err.Error()+"```")
+		}
+		return
+	}
+	_ = sendEmbed(bot, message.ChannelID, "Approval mode updated", "Messages from "+describeChannel(bot, otherChannelID)+": "+describeApproval(reviewChannelID))
+}
+
+func describeApproval(reviewChannelID string) string {
+	if len(reviewChannelID) == 0 {
+		return "proxied without approval"
+	}
+	return "reviewed in <#" + reviewChannelID + ">"
+}
+
+// submitForReview posts a message in the review channel of the target channel, so that moderators can decide whether
+// it should be proxied
+func submitForReview(bot *discordgo.Session, message *discordgo.Message, targetChannelID, reviewChannelID string) error {
+	content := message.Content
+	if runes := []rune(content); len(runes) > maximumEmbedDescriptionLength {
+		content = string(runes[:maximumEmbedDescriptionLength-1]) + "…"
+	}
+	embed := &discordgo.MessageEmbed{
+		Type:        discordgo.EmbedTypeRich,
+		Author:      &discordgo.MessageEmbedAuthor{Name: getAuthorDisplayName(message), IconURL: message.Author.AvatarURL("")},
+		Title:       "Message from " + describeChannel(bot, message.ChannelID),
+		Description: content,
+		Footer:      &discordgo.MessageEmbedFooter{Text: "Approve or reject this message to decide whether it's proxied to #" + getChannelName(bot, targetChannelID)},
+	}
+	if len(message.Attachments) > 0 {
+		var attachments string
+		for _, attachment := range message.Attachments {
+			attachments += "- [" + attachment.Filename + "](" + attachment.URL + ")\n"
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Attachments", Value: attachments})
+	}
+	reviewMessage, err := sendMessageWithButtons(bot, reviewChannelID, embed,
+		&button{Type: componentTypeButton, Style: buttonStyleSuccess, Label: "Approve", CustomID: approveReviewButtonID},
+		&button{Type: componentTypeButton, Style: buttonStyleDanger, Label: "Reject", CustomID: rejectReviewButtonID},
+	)
+	if err != nil {
+		return err
+	}
+	// Reactions are offered as well, for moderators who prefer them over buttons
+	_ = bot.MessageReactionAdd(reviewChannelID, reviewMessage.ID, "✅")
+	_ = bot.MessageReactionAdd(reviewChannelID, reviewMessage.ID, "❌")
+	return database.CreateReview(&database.Review{
+		ReviewChannelID: reviewChannelID,
+		ReviewMessageID: reviewMessage.ID,
+		SourceChannelID: message.ChannelID,
+		SourceMessageID: message.ID,
+		TargetChannelID: targetChannelID,
+		CreatedAt:       time.Now(),
+	})
+}
+
+// approveReview proxies a message that was approved by a moderator
+func approveReview(bot *discordgo.Session, review *database.Review, moderator *discordgo.User) {
+	if err := database.DeleteReview(review.ReviewMessageID); err != nil {
+		// Another moderator already made a decision
+		return
+	}
+	message, err := bot.ChannelMessage(review.SourceChannelID, review.SourceMessageID)
+	if err != nil {
+		log.Printf("[approveReview] Failed to retrieve message=%s: %s", review.SourceMessageID, err.Error())
+		closeReview(bot, review, "Approved by "+moderator.Username+", but the message no longer exists")
+		return
+	}
+	_ = bot.MessageReactionRemove(message.ChannelID, message.ID, "⌛", bot.State.User.ID)
+	if err = proxyMessage(bot, message, review.TargetChannelID); err != nil {
+		log.Printf("[approveReview] Failed to proxy message from=%s to=%s: %s", review.SourceChannelID, review.TargetChannelID, err.Error())
+		_ = bot.MessageReactionAdd(message.ChannelID, message.ID, "❌")
+		closeReview(bot, review, "Approved by "+moderator.Username+", but the message could not be proxied")
+		return
+	}
+	_ = bot.MessageReactionAdd(message.ChannelID, message.ID, "✅")
+	closeReview(bot, review, "Approved by "+moderator.Username)
+}
+
+// rejectReview reports to the channel a message was sent in that the message was rejected by a moderator
+func rejectReview(bot *discordgo.Session, review *database.Review, moderator *discordgo.User, reason string) {
+	if err := database.DeleteReview(review.ReviewMessageID); err != nil {
+		return
+	}
+	if len(reason) == 0 {
+		reason = "No reason was given"
+	}
+	_ = bot.MessageReactionRemove(review.SourceChannelID, review.SourceMessageID, "⌛", bot.State.User.ID)
+	_ = bot.MessageReactionAdd(review.SourceChannelID, review.SourceMessageID, rejectionEmoji)
+	description := "Reason: " + reason
+	if sourceChannel, err := getChannel(bot, review.SourceChannelID); err == nil {
+		description += fmt.Sprintf("\n[Jump to message](https://discord.com/channels/%s/%s/%s)", sourceChannel.GuildID, review.SourceChannelID, review.SourceMessageID)
+	}
+	_ = sendEmbed(bot, review.SourceChannelID, "Message rejected by the moderators of "+describeChannel(bot, review.TargetChannelID), description)
+	closeReview(bot, review, "Rejected by "+moderator.Username+": "+reason)
+}
+
+// closeReview replaces the buttons and reactions of a review by the decision that was made
+func closeReview(bot *discordgo.Session, review *database.Review, decision string) {
+	reviewMessage, err := bot.ChannelMessage(review.ReviewChannelID, review.ReviewMessageID)
+	if err != nil {
+		log.Printf("[closeReview] Failed to retrieve review=%s: %s", review.ReviewMessageID, err.Error())
+		return
+	}
+	embed := firstEmbed(reviewMessage.Embeds)
+	if embed == nil {
+		embed = &discordgo.MessageEmbed{}
+	}
+	embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Decision", Value: decision})
+	payload := map[string]interface{}{"embed": embed, "components": []interface{}{}}
+	endpoint := discordgo.EndpointChannelMessage(review.ReviewChannelID, review.ReviewMessageID)
+	if _, err = bot.RequestWithBucketID("PATCH", endpoint, payload, discordgo.EndpointChannelMessage(review.ReviewChannelID, "")); err != nil {
+		log.Printf("[closeReview] Failed to update review=%s: %s", review.ReviewMessageID, err.Error())
+	}
+	_ = bot.MessageReactionsRemoveAll(review.ReviewChannelID, review.ReviewMessageID)
+}
+
+// deleteReviews deletes the reviews of a message that was deleted before a decision was made
+func deleteReviews(bot *discordgo.Session, sourceMessageID string) {
+	reviews, err := database.GetReviewsBySourceMessageID(sourceMessageID)
+	if err != nil {
+		return
+	}
+	for _, review := range reviews {
+		if err = database.DeleteReview(review.ReviewMessageID); err == nil {
+			_ = bot.ChannelMessageDelete(review.ReviewChannelID, review.ReviewMessageID)
+		}
+	}
+}
+
+// handleReviewReaction approves or rejects a review when a moderator reacts to it with ✅ or ❌, and returns whether
+// the reaction was on a review
+func handleReviewReaction(bot *discordgo.Session, reaction *discordgo.MessageReaction) bool {
+	if reaction.Emoji.Name != "✅" && reaction.Emoji.Name != "❌" {
+		return false
+	}
+	review, err := database.GetReviewByReviewMessageID(reaction.MessageID)
+	if err != nil {
+		return false
+	}
+	member, err := getMember(bot, reaction.GuildID, reaction.UserID)
+	if err != nil {
+		log.Printf("[handleReviewReaction] Failed to retrieve member=%s: %s", reaction.UserID, err.Error())
+		return true
+	}
+	if allowed, _ := canUseCommand(bot, reaction.GuildID, reaction.ChannelID, reaction.UserID, member.Roles, "approve"); !allowed {
+		_ = bot.MessageReactionRemove(reaction.ChannelID, reaction.MessageID, reaction.Emoji.APIName(), reaction.UserID)
+		return true
+	}
+	if reaction.Emoji.Name == "✅" {
+		approveReview(bot, review, member.User)
+	} else {
+		rejectReview(bot, review, member.User, "")
+	}
+	return true
+}
+
+// handleReviewInteraction handles the Approve and Reject buttons of reviews, as well as the form in which moderators
+// give the reason of a rejection
+func handleReviewInteraction(bot *discordgo.Session, i *interaction) {
+	reviewMessageID := strings.TrimPrefix(i.Data.CustomID, rejectReviewButtonID+":")
+	if i.Type == interactionTypeMessageComponent && i.Message != nil {
+		reviewMessageID = i.Message.ID
+	}
+	review, err := database.GetReviewByReviewMessageID(reviewMessageID)
+	if err != nil {
+		_ = respondToInteraction(bot, i, &interactionResponse{Type: interactionResponseTypeChannelMessage, Data: &interactionResponseData{Content: "A decision has already been made for this message", Flags: ephemeralMessageFlag}})
+		return
+	}
+	message := interactionToMessage(i)
+	if allowed, requirement := canUseCommand(bot, message.GuildID, message.ChannelID, message.Author.ID, message.Member.Roles, "approve"); !allowed {
+		_ = respondToInteraction(bot, i, &interactionResponse{Type: interactionResponseTypeChannelMessage, Data: &interactionResponseData{Content: "You are not allowed to review messages. " + requirement, Flags: ephemeralMessageFlag}})
+		return
+	}
+	switch {
+	case i.Type == interactionTypeModalSubmit:
+		_ = respondToInteraction(bot, i, &interactionResponse{Type: interactionResponseTypeDeferredUpdateMessage})
+		rejectReview(bot, review, i.User, getModalValue(i, rejectionReasonInputID))
+	case i.Data.CustomID == approveReviewButtonID:
+		_ = respondToInteraction(bot, i, &interactionResponse{Type: interactionResponseTypeDeferredUpdateMessage})
+		approveReview(bot, review, i.User)
+	case i.Data.CustomID == rejectReviewButtonID:
+		// Ask for the reason of the rejection, which is handled once the form is submitted
+		err = respondToInteraction(bot, i, &interactionResponse{Type: interactionResponseTypeModal, Data: &interactionResponseData{
+			CustomID: rejectReviewButtonID + ":" + review.ReviewMessageID,
+			Title:    "Reject message",
+			Components: []interface{}{
+				&actionRow{Type: componentTypeActionRow, Components: []interface{}{
+					&textInput{Type: componentTypeTextInput, Style: textInputStyleParagraph, Label: "Reason", CustomID: rejectionReasonInputID, MaxLength: 1000},
+				}},
+			},
+		}})
+		if err != nil {
+			log.Printf("[handleReviewInteraction] Failed to ask for the reason of the rejection of review=%s: %s", review.ReviewMessageID, err.Error())
+		}
+	}
+}
+
+// sendMessageWithButtons sends an embed along with buttons, which isn't supported by the version of discordgo used
+func sendMessageWithButtons(bot *discordgo.Session, channelID string, embed *discordgo.MessageEmbed, buttons ...*button) (*discordgo.Message, error) {
+	components := make([]interface{}, 0, len(buttons))
+	for _, b := range buttons {
+		components = append(components, b)
+	}
+	payload := map[string]interface{}{
+		"embed":      embed,
+		"components": []*actionRow{{Type: componentTypeActionRow, Components: components}},
+	}
+	response, err := bot.RequestWithBucketID("POST", discordgo.EndpointChannelMessages(channelID), payload, discordgo.EndpointChannelMessages(channelID))
+	if err != nil {
+		return nil, err
+	}
+	var message *discordgo.Message
+	err = json.Unmarshal(response, &message)
+	return message, err
+}
+
+func getChannelName(bot *discordgo.Session, channelID string) string {
+	if channel, err := getChannel(bot, channelID); err == nil {
+		return channel.Name
+	}
+	return channelID
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	// The bot runs in a scratch image, which doesn't have the time zone database required by lock schedules
+	_ "time/tzdata"
+
+	"github.com/TwiN/discord-channel-proxy-bot/database"
+	"github.com/bwmarrin/discordgo"
+)
+
+var (
+	weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+	weekdaysPresets = map[string]int{
+		"daily":    0b1111111,
+		"weekdays": 0b0111110,
+		"weekends": 0b1000001,
+	}
+)
+
+// HandleLockSchedule shows or configures the recurring schedule outside of which the channel in which the command was
+// sent is locked.
+//
+// Usage: schedule [HH:MM-HH:MM TIMEZONE [DAYS] [pull]|off]
+func HandleLockSchedule(bot *discordgo.Session, channelID, query string) {
+	arguments := strings.Fields(query)
+	if len(arguments) == 0 {
+		schedule, err := database.GetLockSchedule(channelID)
+		if err != nil {
+			if err == database.ErrNotFound {
+				_ = sendEmbed(bot, channelID, "Channel has no lock schedule", fmt.Sprintf("Type `%sschedule 09:00-17:00 Europe/Paris weekdays` to only unlock the channel during these hours", botCommandPrefix))
+			} else {
+				_ = sendEmbed(bot, channelID, "Failed to retrieve lock schedule", "```"+err.Error()+"```")
+			}
+			return
+		}
+		_ = sendEmbed(bot, channelID, "Lock schedule", describeLockSchedule(schedule))
+		return
+	}
+	if strings.ToLower(arguments[0]) == "off" {
+		if err := database.DeleteLockSchedule(channelID); err != nil && err != database.ErrNotFound {
+			_ = sendEmbed(bot, channelID, "Failed to remove lock schedule", "```"+err.Error()+"```")
+			return
+		}
+		_ = sendEmbed(bot, channelID, "Lock schedule removed", "The channel is left in its current state")
+		return
+	}
+	schedule, err := parseLockSchedule(channelID, arguments)
+	if err != nil {
+		_ = sendEmbed(bot, channelID, "Invalid lock schedule", err.Error()+"\nUsage: `"+botCommandPrefix+"schedule HH:MM-HH:MM TIMEZONE [daily|weekdays|weekends|mon,tue,...] [pull]`")
+		return
+	}
+	if err = database.SetLockSchedule(schedule); err != nil {
+		_ = sendEmbed(bot, channelID, "Failed to set lock schedule", "```"+err.Error()+"```")
+		return
+	}
+	_ = sendEmbed(bot, channelID, "Lock schedule set", describeLockSchedule(schedule))
+	applyLockSchedule(bot, schedule, time.Now())
+}
+
+func parseLockSchedule(channelID string, arguments []string) (*database.LockSchedule, error) {
+	if len(arguments) < 2 {
+		return nil, fmt.Errorf("both the hours and the time zone are required")
+	}
+	hours := strings.Split(arguments[0], "-")
+	if len(hours) != 2 {
+		return nil, fmt.Errorf("invalid hours %s", arguments[0])
+	}
+	startMinute, err := parseTimeOfDay(hours[0])
+	if err != nil {
+		return nil, err
+	}
+	endMinute, err := parseTimeOfDay(hours[1])
+	if err != nil {
+		return nil, err
+	}
+	// Such a schedule would never unlock the channel, e.g. 09:00-09:00 or 24:00-00:00
+	if endMinute <= startMinute && (endMinute-startMinute)%(24*60) == 0 {
+		return nil, fmt.Errorf("the channel must be unlocked for part of the day, so the hours must be different")
+	}
+	if _, err = time.LoadLocation(arguments[1]); err != nil {
+		return nil, fmt.Errorf("unknown time zone %s", arguments[1])
+	}
+	schedule := &database.LockSchedule{ChannelID: channelID, StartMinute: startMinute, EndMinute: endMinute, Timezone: arguments[1], Weekdays: weekdaysPresets["daily"]}
+	for _, argument := range arguments[2:] {
+		argument = strings.ToLower(argument)
+		if argument == "pull" {
+			schedule.Pull = true
+		} else if schedule.Weekdays, err = parseWeekdays(argument); err != nil {
+			return nil, err
+		}
+	}
+	return schedule, nil
+}
+
+// parseTimeOfDay parses a time of the day formatted as HH:MM into a number of minutes since midnight
+func parseTimeOfDay(value string) (int, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time %s", value)
+	}
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil || hours < 0 || hours > 24 {
+		return 0, fmt.Errorf("invalid time %s", value)
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil || minutes < 0 || minutes > 59 || (hours == 24 && minutes > 0) {
+		return 0, fmt.Errorf("invalid time %s", value)
+	}
+	return hours*60 + minutes, nil
+}
+
+// parseWeekdays parses either a preset such as weekdays, or a list of days separated by commas (e.g. mon,wed,fri) into
+// a bitmask where the bit of each day is 1 << time.Weekday
+func parseWeekdays(value string) (int, error) {
+	if weekdays, ok := weekdaysPresets[value]; ok {
+		return weekdays, nil
+	}
+	var weekdays int
+	for _, day := range strings.Split(value, ",") {
+		index := -1
+		for i, weekdayName := range weekdayNames {
+			if strings.HasPrefix(day, weekdayName) {
+				index = i
+				break
+			}
+		}
+		if index == -1 {
+			return 0, fmt.Errorf("invalid day %s", day)
+		}
+		weekdays |= 1 << index
+	}
+	return weekdays, nil
+}
+
+func describeLockSchedule(schedule *database.LockSchedule) string {
+	var days []string
+	for preset, weekdays := range weekdaysPresets {
+		if weekdays == schedule.Weekdays {
+			days = []string{preset}
+		}
+	}
+	if days == nil {
+		for i, weekdayName := range weekdayNames {
+			if schedule.Weekdays&(1<<i) != 0 {
+				days = append(days, weekdayName)
+			}
+		}
+	}
+	description := fmt.Sprintf("Unlocked %02d:%02d-%02d:%02d %s (%s), locked the rest of the time", schedule.StartMinute/60, schedule.StartMinute%60, schedule.EndMinute/60, schedule.EndMinute%60, schedule.Timezone, strings.Join(days, ","))
+	if schedule.Pull {
+		description += "\nHeld messages are pulled automatically when the channel is unlocked"
+	}
+	return description
+}
+
+// isWithinSchedule checks whether a channel must be unlocked at the time passed as parameter according to its schedule
+func isWithinSchedule(schedule *database.LockSchedule, now time.Time) bool {
+	location, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		return true
+	}
+	now = now.In(location)
+	minute := now.Hour()*60 + now.Minute()
+	weekday := now.Weekday()
+	if schedule.StartMinute <= schedule.EndMinute {
+		return schedule.Weekdays&(1<<weekday) != 0 && minute >= schedule.StartMinute && minute < schedule.EndMinute
+	}
+	// The channel is unlocked past midnight, in which case the part after midnight belongs to the previous day
+	if minute >= schedule.StartMinute {
+		return schedule.Weekdays&(1<<weekday) != 0
+	}
+	return minute < schedule.EndMinute && schedule.Weekdays&(1<<((weekday+6)%7)) != 0
+}
+
+// runLockScheduler periodically lifts the locks whose timer has expired, and locks or unlocks the channels that have a
+// lock schedule
+func runLockScheduler(bot *discordgo.Session) {
+	for now := range time.Tick(time.Minute) {
+		timers, err := database.GetExpiredLockTimers(now)
+		if err != nil {
+			log.Println("[runLockScheduler] Failed to retrieve expired lock timers:", err.Error())
+		}
+		for _, timer := range timers {
+			// The timer is only deleted once the lock has been lifted, so that unlocking is attempted again next time if
+			// it failed, unless there is nothing left to unlock because the binding no longer exists
+			err = setLock(timer.ChannelID, timer.OtherChannelID, true)
+			if err != nil && err != database.ErrNotFound {
+				log.Printf("[runLockScheduler] Failed to unlock channel=%s: %s", timer.ChannelID, err.Error())
+				continue
+			}
+			if deleteErr := database.DeleteLockTimer(timer.ChannelID, timer.OtherChannelID); deleteErr != nil {
+				log.Printf("[runLockScheduler] Failed to delete lock timer of channel=%s: %s", timer.ChannelID, deleteErr.Error())
+			}
+			if err == database.ErrNotFound {
+				continue
+			}
+			log.Printf("[runLockScheduler] Unlocked channel=%s other=%s because its lock expired", timer.ChannelID, timer.OtherChannelID)
+			if len(timer.OtherChannelID) > 0 {
+				_ = sendEmbed(bot, timer.ChannelID, "Binding with "+timer.OtherChannelID+" has been unlocked automatically", "")
+			} else {
+				_ = sendEmbed(bot, timer.ChannelID, "Channel has been unlocked automatically", "")
+			}
+			if timer.Pull {
+				// Only the messages held by the lock that was lifted are pulled
+				pullHeldMessages(bot, timer.ChannelID, timer.OtherChannelID)
+			}
+		}
+		schedules, err := database.GetLockSchedules()
+		if err != nil {
+			log.Println("[runLockScheduler] Failed to retrieve lock schedules:", err.Error())
+			continue
+		}
+		for _, schedule := range schedules {
+			applyLockSchedule(bot, schedule, now)
+		}
+	}
+}
+
+// applyLockSchedule locks or unlocks a channel if its schedule changed state since it was last applied
+func applyLockSchedule(bot *discordgo.Session, schedule *database.LockSchedule, now time.Time) {
+	locked := !isWithinSchedule(schedule, now)
+	if schedule.Locked.Valid && schedule.Locked.Bool == locked {
+		return
+	}
+	if err := database.LockChannel(schedule.ChannelID, !locked); err != nil {
+		log.Printf("[applyLockSchedule] Failed to apply lock schedule of channel=%s: %s", schedule.ChannelID, err.Error())
+		return
+	}
+	if err := database.SetLockScheduleState(schedule.ChannelID, locked); err != nil {
+		log.Printf("[applyLockSchedule] Failed to persist state of lock schedule of channel=%s: %s", schedule.ChannelID, err.Error())
+	}
+	log.Printf("[applyLockSchedule] Applied lock schedule of channel=%s; locked=%v", schedule.ChannelID, locked)
+	if locked {
+		_ = sendEmbed(bot, schedule.ChannelID, "Channel has been locked as scheduled", "")
+	} else {
+		_ = sendEmbed(bot, schedule.ChannelID, "Channel has been unlocked as scheduled", "")
+		if schedule.Pull {
+			HandlePull(bot, &discordgo.Message{ChannelID: schedule.ChannelID}, "")
+		}
+	}
+}
+
+// setLock locks or unlocks a channel, or only its binding with another channel if otherChannelID isn't empty
+func setLock(channelID, otherChannelID string, unlock bool) error {
+	if len(otherChannelID) > 0 {
+		return database.LockConnection(channelID, otherChannelID, unlock)
+	}
+	return database.LockChannel(channelID, unlock)
+}
+
+// describeLockTimers describes when the timed locks of a channel will be lifted
+func describeLockTimers(timers []*database.LockTimer) string {
+	var description string
+	for _, timer := range timers {
+		if len(timer.OtherChannelID) > 0 {
+			description += fmt.Sprintf("Binding with %s unlocks <t:%d:R>", timer.OtherChannelID, timer.UnlockAt.Unix())
+		} else {
+			description += fmt.Sprintf("Channel unlocks <t:%d:R>", timer.UnlockAt.Unix())
+		}
+		if timer.Pull {
+			description += " (then pulls held messages)"
+		}
+		description += "\n"
+	}
+	return description
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TwiN/discord-channel-proxy-bot/database"
+)
+
+func TestParseLockSchedule(t *testing.T) {
+	scenarios := []struct {
+		name             string
+		arguments        string
+		expectedSchedule *database.LockSchedule
+		expectedErr      bool
+	}{
+		{
+			name:             "daily",
+			arguments:        "09:00-17:00 Europe/Paris",
+			expectedSchedule: &database.LockSchedule{ChannelID: "1", StartMinute: 9 * 60, EndMinute: 17 * 60, Timezone: "Europe/Paris", Weekdays: 0b1111111},
+		},
+		{
+			name:             "weekdays-with-pull",
+			arguments:        "09:30-17:45 UTC weekdays pull",
+			expectedSchedule: &database.LockSchedule{ChannelID: "1", StartMinute: 9*60 + 30, EndMinute: 17*60 + 45, Timezone: "UTC", Weekdays: 0b0111110, Pull: true},
+		},
+		{
+			name:             "list-of-days",
+			arguments:        "08:00-12:00 UTC mon,wed,fri",
+			expectedSchedule: &database.LockSchedule{ChannelID: "1", StartMinute: 8 * 60, EndMinute: 12 * 60, Timezone: "UTC", Weekdays: 0b0101010},
+		},
+		{
+			name:             "past-midnight",
+			arguments:        "22:00-02:00 UTC",
+			expectedSchedule: &database.LockSchedule{ChannelID: "1", StartMinute: 22 * 60, EndMinute: 2 * 60, Timezone: "UTC", Weekdays: 0b1111111},
+		},
+		{
+			name:             "whole-day",
+			arguments:        "00:00-24:00 UTC",
+			expectedSchedule: &database.LockSchedule{ChannelID: "1", StartMinute: 0, EndMinute: 24 * 60, Timezone: "UTC", Weekdays: 0b1111111},
+		},
+		{
+			name:        "missing-timezone",
+			arguments:   "09:00-17:00",
+			expectedErr: true,
+		},
+		{
+			name:        "unknown-timezone",
+			arguments:   "09:00-17:00 Mars/Olympus",
+			expectedErr: true,
+		},
+		{
+			name:        "invalid-hours",
+			arguments:   "09:00 UTC",
+			expectedErr: true,
+		},
+		{
+			name:        "invalid-time",
+			arguments:   "09:60-17:00 UTC",
+			expectedErr: true,
+		},
+		{
+			name:        "start-equals-end",
+			arguments:   "09:00-09:00 UTC",
+			expectedErr: true,
+		},
+		{
+			name:        "midnight-to-midnight",
+			arguments:   "24:00-00:00 UTC",
+			expectedErr: true,
+		},
+		{
+			name:        "invalid-day",
+			arguments:   "09:00-17:00 UTC someday",
+			expectedErr: true,
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			schedule, err := parseLockSchedule("1", strings.Fields(scenario.arguments))
+			if scenario.expectedErr {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", schedule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("expected no error, got", err.Error())
+			}
+			if *schedule != *scenario.expectedSchedule {
+				t.Errorf("expected %+v, got %+v", scenario.expectedSchedule, schedule)
+			}
+		})
+	}
+}
+
+func TestIsWithinSchedule(t *testing.T) {
+	officeHours := &database.LockSchedule{StartMinute: 9 * 60, EndMinute: 17 * 60, Timezone: "UTC", Weekdays: weekdaysPresets["weekdays"]}
+	nightShift := &database.LockSchedule{StartMinute: 22 * 60, EndMinute: 2 * 60, Timezone: "UTC", Weekdays: weekdaysPresets["weekdays"]}
+	parisOfficeHours := &database.LockSchedule{StartMinute: 9 * 60, EndMinute: 17 * 60, Timezone: "Europe/Paris", Weekdays: weekdaysPresets["daily"]}
+	// 2024-01-01 is a Monday
+	monday := func(hour, minute int) time.Time {
+		return time.Date(2024, time.January, 1, hour, minute, 0, 0, time.UTC)
+	}
+	scenarios := []struct {
+		name     string
+		schedule *database.LockSchedule
+		now      time.Time
+		expected bool
+	}{
+		{name: "within-hours", schedule: officeHours, now: monday(10, 0), expected: true},
+		{name: "at-start", schedule: officeHours, now: monday(9, 0), expected: true},
+		{name: "before-start", schedule: officeHours, now: monday(8, 59), expected: false},
+		{name: "at-end", schedule: officeHours, now: monday(17, 0), expected: false},
+		{name: "day-not-in-schedule", schedule: officeHours, now: monday(10, 0).AddDate(0, 0, 5), expected: false},
+		{name: "past-midnight-before-midnight", schedule: nightShift, now: monday(23, 0), expected: true},
+		{name: "past-midnight-after-midnight", schedule: nightShift, now: monday(1, 0).AddDate(0, 0, 1), expected: true},
+		{name: "past-midnight-after-midnight-of-last-day", schedule: nightShift, now: monday(1, 0).AddDate(0, 0, 5), expected: true},
+		{name: "past-midnight-after-midnight-of-day-not-in-schedule", schedule: nightShift, now: monday(1, 0), expected: false},
+		{name: "past-midnight-outside-hours", schedule: nightShift, now: monday(12, 0), expected: false},
+		{name: "time-zone", schedule: parisOfficeHours, now: monday(8, 30), expected: true},
+		{name: "time-zone-outside-hours", schedule: parisOfficeHours, now: monday(16, 30), expected: false},
+		{name: "unknown-time-zone", schedule: &database.LockSchedule{StartMinute: 9 * 60, EndMinute: 17 * 60, Timezone: "Mars/Olympus"}, now: monday(0, 0), expected: true},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			if within := isWithinSchedule(scenario.schedule, scenario.now); within != scenario.expected {
+				t.Errorf("expected %v, got %v", scenario.expected, within)
+			}
+		})
+	}
+}
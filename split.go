@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+)
+
+const (
+	// maximumMessageLength is the maximum number of characters Discord allows in the content of a message
+	maximumMessageLength = 2000
+
+	codeBlockFence = "```"
+)
+
+// splitMessageContent splits content into parts that are no longer than maximumLength characters.
+//
+// Content is split at newlines whenever possible, and code blocks are kept whole unless a single code block is too
+// long to fit in a part, in which case it is split into several code blocks.
+// There is always at least one part, even if the content is empty.
+func splitMessageContent(content string, maximumLength int) []string {
+	if runeCount(content) <= maximumLength {
+		return []string{content}
+	}
+	var parts []string
+	var current string
+	// A part can't be considered started based on whether it's empty, since pieces may be blank lines
+	var started bool
+	for _, segment := range splitSegments(content) {
+		for _, piece := range splitSegment(segment, maximumLength) {
+			if !started {
+				current, started = piece, true
+			} else if runeCount(current)+1+runeCount(piece) <= maximumLength {
+				current += "\n" + piece
+			} else {
+				parts = append(parts, current)
+				current = piece
+			}
+		}
+	}
+	return append(parts, current)
+}
+
+// splitSegments splits content into segments that should ideally not be split any further, which are either a single
+// line, or an entire code block
+func splitSegments(content string) []string {
+	var segments []string
+	var codeBlock []string
+	for _, line := range strings.Split(content, "\n") {
+		fences := strings.Count(line, codeBlockFence)
+		if codeBlock != nil {
+			codeBlock = append(codeBlock, line)
+			if fences%2 == 1 {
+				segments = append(segments, strings.Join(codeBlock, "\n"))
+				codeBlock = nil
+			}
+		} else if fences%2 == 1 {
+			codeBlock = []string{line}
+		} else {
+			segments = append(segments, line)
+		}
+	}
+	if codeBlock != nil {
+		// The code block was never closed, so Discord won't render it as a code block anyway
+		segments = append(segments, codeBlock...)
+	}
+	return segments
+}
+
+// splitSegment splits a segment into pieces that are no longer than maximumLength characters
+func splitSegment(segment string, maximumLength int) []string {
+	if runeCount(segment) <= maximumLength {
+		return []string{segment}
+	}
+	lines := strings.Split(segment, "\n")
+	if len(lines) == 1 {
+		return splitLine(segment, maximumLength)
+	}
+	// The segment is a code block that is too long, so it must be split into several code blocks.
+	// Each piece is closed, and the next one is opened with the same fence to preserve the language.
+	opening := lines[0][strings.Index(lines[0], codeBlockFence):]
+	// Leave enough room for closing the code block
+	budget := maximumLength - len("\n"+codeBlockFence)
+	if strings.ContainsAny(opening[len(codeBlockFence):], " `") || runeCount(opening) > budget/2 {
+		// An opening line that long isn't a language, and repeating it would leave little to no room for the content
+		opening = codeBlockFence
+	}
+	chunkLength := budget - runeCount(opening) - 1
+	if chunkLength < 1 {
+		chunkLength = 1
+	}
+	var pieces []string
+	var current string
+	for i, line := range lines {
+		for _, chunk := range splitLine(line, chunkLength) {
+			if i == 0 && len(current) == 0 {
+				current = chunk
+			} else if runeCount(current)+1+runeCount(chunk) <= budget {
+				current += "\n" + chunk
+			} else {
+				pieces = append(pieces, current+"\n"+codeBlockFence)
+				current = opening + "\n" + chunk
+			}
+		}
+	}
+	return append(pieces, current)
+}
+
+// splitLine splits a single line into pieces that are no longer than maximumLength characters, preferably at spaces
+func splitLine(line string, maximumLength int) []string {
+	var pieces []string
+	runes := []rune(line)
+	for len(runes) > maximumLength {
+		cut := maximumLength
+		for i := maximumLength; i > maximumLength/2; i-- {
+			if runes[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+		pieces = append(pieces, string(runes[:cut]))
+		runes = []rune(strings.TrimLeft(string(runes[cut:]), " "))
+	}
+	return append(pieces, string(runes))
+}
+
+func runeCount(s string) int {
+	return len([]rune(s))
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitMessageContent(t *testing.T) {
+	scenarios := []struct {
+		name          string
+		content       string
+		maximumLength int
+		expectedParts []string
+	}{
+		{
+			name:          "empty",
+			content:       "",
+			maximumLength: 10,
+			expectedParts: []string{""},
+		},
+		{
+			name:          "short",
+			content:       "hello",
+			maximumLength: 10,
+			expectedParts: []string{"hello"},
+		},
+		{
+			name:          "split-at-newlines",
+			content:       "aaaa\nbbbb\ncccc",
+			maximumLength: 9,
+			expectedParts: []string{"aaaa\nbbbb", "cccc"},
+		},
+		{
+			name:          "blank-line-at-end-of-part",
+			content:       "aaaa\n\nbbbb",
+			maximumLength: 5,
+			expectedParts: []string{"aaaa\n", "bbbb"},
+		},
+		{
+			name:          "blank-line-at-start-of-part",
+			content:       "aaaaa\n\nbb",
+			maximumLength: 5,
+			expectedParts: []string{"aaaaa", "\nbb"},
+		},
+		{
+			name:          "long-line-split-at-space",
+			content:       "hello world foo",
+			maximumLength: 11,
+			expectedParts: []string{"hello world", "foo"},
+		},
+		{
+			name:          "code-block-kept-whole",
+			content:       "intro\n```go\nfmt.Println()\n```",
+			maximumLength: 25,
+			expectedParts: []string{"intro", "```go\nfmt.Println()\n```"},
+		},
+		{
+			name:          "multibyte-characters",
+			content:       "ééééé\nààààà",
+			maximumLength: 5,
+			expectedParts: []string{"ééééé", "ààààà"},
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			parts := splitMessageContent(scenario.content, scenario.maximumLength)
+			if !reflect.DeepEqual(parts, scenario.expectedParts) {
+				t.Errorf("expected %q, got %q", scenario.expectedParts, parts)
+			}
+			for _, part := range parts {
+				if runeCount(part) > scenario.maximumLength {
+					t.Errorf("part %q is longer than %d characters", part, scenario.maximumLength)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitSegment(t *testing.T) {
+	scenarios := []struct {
+		name           string
+		segment        string
+		maximumLength  int
+		expectedPieces []string
+	}{
+		{
+			name:           "short",
+			segment:        "hello",
+			maximumLength:  10,
+			expectedPieces: []string{"hello"},
+		},
+		{
+			name:           "line",
+			segment:        "aaaa bbbb cccc",
+			maximumLength:  10,
+			expectedPieces: []string{"aaaa bbbb", "cccc"},
+		},
+		{
+			name:           "line-without-spaces",
+			segment:        "aaaaaaaaaaaa",
+			maximumLength:  5,
+			expectedPieces: []string{"aaaaa", "aaaaa", "aa"},
+		},
+		{
+			name:           "code-block-with-language",
+			segment:        "```go\naaaa\nbbbb\ncccc\n```",
+			maximumLength:  18,
+			expectedPieces: []string{"```go\naaaa\n```", "```go\nbbbb\n```", "```go\ncccc\n```"},
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			pieces := splitSegment(scenario.segment, scenario.maximumLength)
+			if !reflect.DeepEqual(pieces, scenario.expectedPieces) {
+				t.Errorf("expected %q, got %q", scenario.expectedPieces, pieces)
+			}
+			for _, piece := range pieces {
+				if runeCount(piece) > scenario.maximumLength {
+					t.Errorf("piece %q is longer than %d characters", piece, scenario.maximumLength)
+				}
+			}
+		})
+	}
+}
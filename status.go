@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/TwiN/discord-channel-proxy-bot/database"
+	"github.com/bwmarrin/discordgo"
+)
+
+// requiredPermissions are the permissions the bot needs in a bound channel to work properly, along with their names
+var requiredPermissions = []struct {
+	Permission int64
+	Name       string
+}{
+	{discordgo.PermissionViewChannel, "View Channel"},
+	{discordgo.PermissionSendMessages, "Send Messages"},
+	{discordgo.PermissionReadMessageHistory, "Read Message History"},
+	{discordgo.PermissionEmbedLinks, "Embed Links"},
+	{discordgo.PermissionAttachFiles, "Attach Files"},
+	{discordgo.PermissionAddReactions, "Add Reactions"},
+	{discordgo.PermissionManageMessages, "Manage Messages"},
+	{discordgo.PermissionManageWebhooks, "Manage Webhooks"},
+}
+
+// HandleStatus shows every binding of the channel in which the command was sent, along with its direction.
+// Each two-way binding is shown with the lock state of both sides, when it was created, how many messages went through
+// it, and whether the bot is missing permissions in either channel.
+func HandleStatus(bot *discordgo.Session, channelID string) {
+	var fields []*discordgo.MessageEmbedField
+	connectedChannelIDs, _ := database.GetConnectedChannelIDs(channelID)
+	for _, connectedChannelID := range connectedChannelIDs {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Bound to " + describeChannel(bot, connectedChannelID), Value: describeBinding(bot, channelID, connectedChannelID)})
+	}
+	if hubName, err := database.GetHubNameByChannelID(channelID); err == nil {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Hub (both ways)", Value: hubName})
+	}
+	if publisherChannelIDs, err := database.GetPublisherChannelIDs(channelID); err == nil && len(publisherChannelIDs) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Subscribed to (one way, incoming)", Value: describeChannels(bot, publisherChannelIDs)})
+	}
+	if subscriberChannelIDs, err := database.GetSubscriberChannelIDs(channelID); err == nil && len(subscriberChannelIDs) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Subscribers (one way, outgoing)", Value: describeChannels(bot, subscriberChannelIDs)})
+	}
+	embed := &discordgo.MessageEmbed{Title: "Channel status", Fields: fields}
+	if len(fields) == 0 {
+		embed.Description = "This channel is not bound to any channel"
+	} else {
+		embed.Description = "Channel locked: " + formatBool(database.IsChannelLocked(channelID))
+		if timers, err := database.GetLockTimersByChannelID(channelID); err == nil && len(timers) > 0 {
+			embed.Description += "\n" + strings.TrimSuffix(describeLockTimers(timers), "\n")
+		}
+		if schedule, err := database.GetLockSchedule(channelID); err == nil {
+			embed.Description += "\nLock schedule: " + describeLockSchedule(schedule)
+		}
+		embed.Description += "\nPermissions: " + describePermissionHealth(bot, channelID)
+	}
+	if _, err := bot.ChannelMessageSendEmbed(channelID, embed); err != nil {
+		log.Println("[HandleStatus] Failed to send status:", err.Error())
+	}
+}
+
+// describeBinding describes the two-way binding between a channel and another channel
+func describeBinding(bot *discordgo.Session, channelID, otherChannelID string) string {
+	description := fmt.Sprintf("Locked here: %s (channel), %s (binding)\n", formatBool(database.IsChannelLocked(channelID)), formatBool(database.IsConnectionLocked(channelID, otherChannelID)))
+	description += fmt.Sprintf("Locked there: %s (channel), %s (binding)\n", formatBool(database.IsChannelLocked(otherChannelID)), formatBool(database.IsConnectionLocked(otherChannelID, channelID)))
+	if createdAt, err := database.GetConnectionCreatedAt(channelID, otherChannelID); err == nil && !createdAt.IsZero() {
+		description += fmt.Sprintf("Created: <t:%d:f>\n", createdAt.Unix())
+	} else {
+		description += "Created: unknown\n"
+	}
+	sent, _ := database.CountProxiedMessages(channelID, otherChannelID)
+	received, _ := database.CountProxiedMessages(otherChannelID, channelID)
+	description += fmt.Sprintf("Messages: %d sent, %d received\n", sent, received)
+	description += "Incoming messages: " + describeApproval(database.GetReviewChannelID(otherChannelID, channelID)) + "\n"
+	description += "Permissions there: " + describePermissionHealth(bot, otherChannelID)
+	return description
+}
+
+// describePermissionHealth returns the permissions the bot is missing in a channel, or OK if there are none
+func describePermissionHealth(bot *discordgo.Session, channelID string) string {
+	permissions, err := bot.UserChannelPermissions(bot.State.User.ID, channelID)
+	if err != nil {
+		return "unable to verify (the bot may no longer have access to the channel)"
+	}
+	var missing []string
+	for _, requiredPermission := range requiredPermissions {
+		if permissions&requiredPermission.Permission != requiredPermission.Permission {
+			missing = append(missing, requiredPermission.Name)
+		}
+	}
+	if len(missing) == 0 {
+		return "OK"
+	}
+	return "missing " + strings.Join(missing, ", ")
+}
+
+func formatBool(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+func describeChannels(bot *discordgo.Session, channelIDs []string) string {
+	var description string
+	for _, channelID := range channelIDs {
+		description += "- " + describeChannel(bot, channelID) + "\n"
+	}
+	return description
+}
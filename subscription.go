@@ -0,0 +1,96 @@
+package main
+
+import (
+	"log"
+
+	"github.com/TwiN/discord-channel-proxy-bot/database"
+	"github.com/bwmarrin/discordgo"
+)
+
+// HandleSubscription handles the publish and subscribe commands, which create a one-way connection through which
+// messages are only proxied from the publisher channel to the subscriber channel.
+//
+// Just like with HandleBind, the connection is only created once both channels have agreed to it: the publisher with
+// the publish command, and the subscriber with the subscribe command, in any order.
+func HandleSubscription(bot *discordgo.Session, fromChannelID, toChannelID string, publish bool) {
+	if fromChannelID == toChannelID {
+		_ = sendEmbed(bot, fromChannelID, "You can't subscribe a channel to itself", "")
+		return
+	}
+	publisherChannelID, subscriberChannelID := fromChannelID, toChannelID
+	requestType, expectedRequestType := database.RequestTypePublish, database.RequestTypeSubscribe
+	if !publish {
+		publisherChannelID, subscriberChannelID = toChannelID, fromChannelID
+		requestType, expectedRequestType = expectedRequestType, requestType
+	}
+	// Check if the target has already sent the matching request
+	if err := database.ConsumeBindRequest(expectedRequestType, toChannelID, fromChannelID); err == nil {
+		if err := database.CreateOneWayConnection(publisherChannelID, subscriberChannelID); err != nil {
+			log.Printf("[HandleSubscription] Failed to create one-way connection from %s to %s: %s", publisherChannelID, subscriberChannelID, err.Error())
+			_ = sendEmbed(bot, fromChannelID, "Failed to create subscription", "```"+err.Error()+"```")
+			return
+		}
+		log.Println("[HandleSubscription] Created one-way connection from", publisherChannelID, "to", subscriberChannelID)
+		_ = sendEmbed(bot, publisherChannelID, "Channel "+subscriberChannelID+" is now subscribed to this channel", "")
+		_ = sendEmbed(bot, subscriberChannelID, "Channel is now subscribed to "+publisherChannelID, "")
+		return
+	}
+	err := sendBindRequest(bot, newBindRequest(requestType, fromChannelID, toChannelID))
+	if err != nil {
+		_ = sendEmbed(bot, fromChannelID, "Failed to send subscription request", "```"+err.Error()+"```")
+		return
+	}
+	_ = sendEmbed(bot, fromChannelID, "Subscription request sent", "")
+}
+
+// HandleUnsubscribe deletes the one-way connection between the channel in which the command was sent and another
+// channel, regardless of which of the two channels is the publisher.
+// The other channel may be omitted if the channel only has one one-way connection.
+func HandleUnsubscribe(bot *discordgo.Session, channelID, otherChannel string) {
+	otherChannelID := parseChannelID(otherChannel)
+	if len(otherChannelID) == 0 {
+		if otherChannelID = resolveSubscriptionChannelID(bot, channelID); len(otherChannelID) == 0 {
+			return
+		}
+	}
+	err := database.DeleteOneWayConnection(otherChannelID, channelID)
+	if err == database.ErrNotFound {
+		err = database.DeleteOneWayConnection(channelID, otherChannelID)
+	}
+	if err != nil {
+		if err == database.ErrNotFound {
+			_ = sendEmbed(bot, channelID, "Channel has no subscription with "+otherChannelID, "")
+		} else {
+			_ = sendEmbed(bot, channelID, "Failed to unsubscribe", "```"+err.Error()+"```")
+		}
+		return
+	}
+	_ = sendEmbed(bot, channelID, "Unsubscribed successfully", "")
+}
+
+// resolveSubscriptionChannelID returns the ID of the only channel the channel passed as parameter is subscribed to or
+// has as subscriber.
+// If the channel doesn't have exactly one such channel, the user is told so and an empty string is returned.
+func resolveSubscriptionChannelID(bot *discordgo.Session, channelID string) string {
+	publisherChannelIDs, err := database.GetPublisherChannelIDs(channelID)
+	if err != nil {
+		log.Println("[resolveSubscriptionChannelID] Failed to get publisher channel IDs:", err.Error())
+		return ""
+	}
+	subscriberChannelIDs, err := database.GetSubscriberChannelIDs(channelID)
+	if err != nil {
+		log.Println("[resolveSubscriptionChannelID] Failed to get subscriber channel IDs:", err.Error())
+		return ""
+	}
+	channelIDs := append(publisherChannelIDs, subscriberChannelIDs...)
+	switch len(channelIDs) {
+	case 0:
+		_ = sendEmbed(bot, channelID, "Channel has no subscriptions", "")
+		return ""
+	case 1:
+		return channelIDs[0]
+	default:
+		_ = sendEmbed(bot, channelID, "Channel has several subscriptions", "Please specify which channel:\n"+describeChannels(bot, channelIDs))
+		return ""
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"regexp"
+
+	"github.com/TwiN/discord-channel-proxy-bot/database"
+	"github.com/bwmarrin/discordgo"
+)
+
+var (
+	errWebhookNoLongerExists = errors.New("the webhook that sent this message no longer exists")
+
+	// reservedWebhookNameRegex matches the words Discord doesn't allow in the name of a webhook or in the username of
+	// a webhook message, split in two so that they can be broken up
+	reservedWebhookNameRegex = regexp.MustCompile(`(?i)(disc)(ord)|(cly)(de)`)
+)
+
+const (
+	// webhookName is the name of the webhooks created to proxy messages, which must not contain "discord"
+	webhookName = "channel-proxy-bot"
+
+	// maximumWebhookUsernameLength is the maximum length Discord allows for the username of a webhook message
+	maximumWebhookUsernameLength = 80
+)
+
+// getOrCreateWebhook returns the webhook used to proxy messages to a channel, creating it if it doesn't exist yet
+func getOrCreateWebhook(bot *discordgo.Session, channelID string) (*discordgo.Webhook, error) {
+	webhookID, webhookToken, err := database.GetWebhook(channelID)
+	if err == nil {
+		return &discordgo.Webhook{ID: webhookID, Token: webhookToken, ChannelID: channelID}, nil
+	}
+	if err != database.ErrNotFound {
+		return nil, err
+	}
+	webhook, err := bot.WebhookCreate(channelID, webhookName, "")
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[getOrCreateWebhook] Created webhook=%s for channel=%s", webhook.ID, channelID)
+	if err := database.SetWebhook(channelID, webhook.ID, webhook.Token); err != nil {
+		log.Printf("[getOrCreateWebhook] Failed to persist webhook=%s for channel=%s: %s", webhook.ID, channelID, err.Error())
+	}
+	return webhook, nil
+}
+
+// sendWithWebhook sends a message to a channel through the channel's webhook.
+// If the webhook has been deleted, a new one is created and the message is sent again.
+func sendWithWebhook(bot *discordgo.Session, channelID string, params *discordgo.WebhookParams, files []*attachmentFile) (*discordgo.Message, error) {
+	webhook, err := getOrCreateWebhook(bot, channelID)
+	if err != nil {
+		return nil, err
+	}
+	message, err := executeWebhook(bot, webhook, params, files)
+	if err != nil && isRESTError(err, discordgo.ErrCodeUnknownWebhook) {
+		log.Printf("[sendWithWebhook] Webhook=%s for channel=%s no longer exists, creating a new one", webhook.ID, channelID)
+		_ = database.DeleteWebhook(channelID)
+		if webhook, err = getOrCreateWebhook(bot, channelID); err != nil {
+			return nil, err
+		}
+		message, err = executeWebhook(bot, webhook, params, files)
+	}
+	return message, err
+}
+
+// executeWebhook sends a message through a webhook and waits for the message to be created.
+// Unlike discordgo's WebhookExecute, this supports uploading files.
+func executeWebhook(bot *discordgo.Session, webhook *discordgo.Webhook, params *discordgo.WebhookParams, files []*attachmentFile) (*discordgo.Message, error) {
+	if len(files) == 0 {
+		return bot.WebhookExecute(webhook.ID, webhook.Token, true, params)
+	}
+	payload, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	contentType, body, err := buildMultipartBody(payload, files)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := discordgo.EndpointWebhookToken(webhook.ID, webhook.Token) + "?wait=true"
+	response, err := bot.RequestWithLockedBucket("POST", endpoint, contentType, body, bot.Ratelimiter.LockBucket(discordgo.EndpointWebhookToken("", "")), 0)
+	if err != nil {
+		return nil, err
+	}
+	var message *discordgo.Message
+	err = json.Unmarshal(response, &message)
+	return message, err
+}
+
+// editWithWebhook edits a message that was previously sent through the webhook of the channel it was sent in, replacing
+// its content and embeds entirely
+func editWithWebhook(bot *discordgo.Session, proxiedMessage *database.ProxiedMessage, params *discordgo.WebhookParams) error {
+	webhookID, webhookToken, err := database.GetWebhook(proxiedMessage.ProxyChannelID)
+	if err != nil {
+		return err
+	}
+	if webhookID != proxiedMessage.WebhookID {
+		// Messages can only be edited through the webhook that sent them
+		return errWebhookNoLongerExists
+	}
+	payload := &webhookMessageEdit{Content: params.Content, Embeds: params.Embeds, AllowedMentions: params.AllowedMentions}
+	if payload.Embeds == nil {
+		payload.Embeds = []*discordgo.MessageEmbed{}
+	}
+	_, err = bot.RequestWithBucketID("PATCH", webhookMessageEndpoint(webhookID, webhookToken, proxiedMessage.ProxyMessageID), payload, webhookMessageEndpoint("", "", ""))
+	return err
+}
+
+// webhookMessageEdit is the payload of an edit of a message sent through a webhook.
+// Unlike discordgo.WebhookParams, the content and the embeds are always sent, since omitting them leaves them
+// unchanged rather than removing them.
+type webhookMessageEdit struct {
+	Content         string                            `json:"content"`
+	Embeds          []*discordgo.MessageEmbed         `json:"embeds"`
+	AllowedMentions *discordgo.MessageAllowedMentions `json:"allowed_mentions,omitempty"`
+}
+
+// deleteWithWebhook deletes a message that was previously sent through the webhook of the channel it was sent in
+func deleteWithWebhook(bot *discordgo.Session, proxiedMessage *database.ProxiedMessage) error {
+	webhookID, webhookToken, err := database.GetWebhook(proxiedMessage.ProxyChannelID)
+	if err != nil {
+		return err
+	}
+	if webhookID != proxiedMessage.WebhookID {
+		return errWebhookNoLongerExists
+	}
+	_, err = bot.RequestWithBucketID("DELETE", webhookMessageEndpoint(webhookID, webhookToken, proxiedMessage.ProxyMessageID), nil, webhookMessageEndpoint("", "", ""))
+	return err
+}
+
+func webhookMessageEndpoint(webhookID, webhookToken, messageID string) string {
+	return discordgo.EndpointWebhookToken(webhookID, webhookToken) + "/messages/" + messageID
+}
+
+// getAuthorDisplayName returns the nickname of the author of a message if there is one, or the username otherwise
+func getAuthorDisplayName(message *discordgo.Message) string {
+	name := message.Author.Username
+	if message.Member != nil && len(message.Member.Nick) > 0 {
+		name = message.Member.Nick
+	}
+	if runes := []rune(name); len(runes) > maximumWebhookUsernameLength {
+		name = string(runes[:maximumWebhookUsernameLength])
+	}
+	return name
+}
+
+// getWebhookUsername returns the name under which a message is proxied through a webhook.
+// Discord rejects usernames that contain "discord" or "clyde", so these words are broken up with a zero-width space.
+func getWebhookUsername(message *discordgo.Message) string {
+	name := reservedWebhookNameRegex.ReplaceAllString(getAuthorDisplayName(message), "${1}${3}"+zeroWidthSpace+"${2}${4}")
+	if runes := []rune(name); len(runes) > maximumWebhookUsernameLength {
+		name = string(runes[:maximumWebhookUsernameLength])
+	}
+	return name
+}
+
+// isRESTError checks whether an error returned by Discord's API has the code passed as parameter
+func isRESTError(err error, code int) bool {
+	restErr, ok := err.(*discordgo.RESTError)
+	return ok && restErr.Message != nil && restErr.Message.Code == code
+}